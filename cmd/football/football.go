@@ -97,8 +97,8 @@ func main() {
 
 	network := goflare.NewNetwork(
 		[]goflare.Layer{
-			goflare.NewLayer(2, 10, goflare.Sigmoid),
-			goflare.NewLayer(10, 3, goflare.Sigmoid),
+			goflare.NewDenseLayer(2, 10, goflare.Sigmoid, goflare.WithInitializer(goflare.XavierUniformInit)),
+			goflare.NewDenseLayer(10, 3, goflare.Softmax, goflare.WithInitializer(goflare.XavierUniformInit)),
 		},
 	)
 
@@ -117,20 +117,25 @@ func main() {
 		logrus.Infoln(goflare.NewConfusionMatrix([]string{"Home win", "tie", "Away win"}, actual, predictions))
 	}
 
-	optimizer := goflare.NewOptimizer(&network, goflare.MSELoss, 0.01, 0)
+	optimizer := goflare.NewSGD(&network, goflare.CrossEntropyLoss, 0.01, 0)
 	trainer := goflare.NetworkTrainer{}
 	loader := goflare.NewDataLoader(trainData, 10, true)
 
 	// debugSvr := tools.NewDebugServer(&network, testData, *goflare.NewDataLoader(trainData, 10, true), optimizer)
 	// debugSvr.Run("localhost:5000")
 
-	for i := 0; ; i++ {
-		runningLoss := trainer.Train(&network, loader, optimizer)
-		if i%5000 == 0 {
-			logrus.Infof("[%4d] Train data loss = %f\n", i, runningLoss)
-			testNetwork(trainData)
-			testNetwork(testData)
-		}
-	}
-
+	_, err = trainer.Fit(&network, loader, optimizer, goflare.FitOptions{
+		Callbacks: []goflare.Callback{
+			goflare.CallbackFuncs{
+				EpochEnd: func(ctx *goflare.FitContext, logs goflare.EpochLogs) {
+					if ctx.Epoch%5000 == 0 {
+						logrus.Infof("[%4d] Train data loss = %f\n", ctx.Epoch, logs["loss"])
+						testNetwork(trainData)
+						testNetwork(testData)
+					}
+				},
+			},
+		},
+	})
+	check(err)
 }
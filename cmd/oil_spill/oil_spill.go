@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"io/fs"
 	"math/rand"
+	"os"
 	"time"
 
 	"github.com/jjunac/goflare/goflare"
@@ -18,6 +21,7 @@ func check(e error) {
 
 func main() {
 	isDebug := flag.Bool("debug", false, "display debug logs")
+	modelPath := flag.String("model", "", "file to save the network to, and to resume the training from if it exists")
 	flag.Parse()
 	if *isDebug {
 		logrus.SetLevel(logrus.DebugLevel)
@@ -25,36 +29,45 @@ func main() {
 		logrus.SetLevel(logrus.InfoLevel)
 	}
 
-	pipeline := goflare.NewDataPipeline(50, []int{49})
-	pipeline.AddRowProcessor(goflare.PPToFloats())
-	pipeline.AddInputProcessor(goflare.PPNormalizer())
-
 	data, err := goflare.CSVDataStream(".datasets/oil_spill.csv")
 	check(err)
+
+	targetEncoder := goflare.NewTargetEncoder()
+	pipeline, err := goflare.NewDataPipelineFromSchema(data.Schema(), []string{"target"})
+	check(err)
+	pipeline.AddInputProcessor(goflare.PPToFloats())
+	pipeline.AddInputProcessor(goflare.PPStandardScaler())
+	pipeline.AddTargetProcessor(targetEncoder.Processor())
+
 	err = data.ApplyPipeline(pipeline)
 	check(err)
-	dataset, err := data.ToDataset([]int{49})
+	dataset, err := data.ToDatasetByName("target")
 	check(err)
-
-	for i := range dataset {
-		output := []float64{0, 0}
-		if dataset[i].Outputs[0] < 0.5 {
-			output[0] = 1
-		} else {
-			output[1] = 1
-		}
-		dataset[i].Outputs = output
-	}
+	classes := targetEncoder.Classes()
 
 	rand.Seed(time.Now().UnixNano())
 	network := goflare.NewNetwork(
 		[]goflare.Layer{
-			goflare.NewLayer(49, 25, goflare.ReLU),
-			goflare.NewLayer(25, 2, goflare.Sigmoid),
+			goflare.NewDenseLayer(49, 25, goflare.ReLU, goflare.WithInitializer(goflare.HeUniformInit)),
+			goflare.NewDenseLayer(25, len(classes), goflare.Softmax, goflare.WithInitializer(goflare.XavierUniformInit)),
 		},
 	)
+	var optimizerState *goflare.OptimizerState
+	if *modelPath != "" {
+		f, err := os.Open(*modelPath)
+		if err == nil {
+			var loaded *goflare.Network
+			loaded, optimizerState, err = goflare.LoadCheckpoint(f)
+			f.Close()
+			check(err)
+			network = *loaded
+			logrus.Infof("Resuming the training from %s", *modelPath)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			check(err)
+		}
+	}
 
-	trainData, testData := goflare.RandomSplit2(dataset, 7, 3)
+	trainData, testData := goflare.StratifiedSplit2(dataset, 7, 3)
 
 	testNetwork := func(name string, data goflare.Dataset) {
 		total := len(data)
@@ -66,32 +79,65 @@ func main() {
 			predictions[i] = network.Evaluate(data[i].Inputs)
 		}
 
-		logrus.Infof("%s data loss = %f\n", name, network.AvgLoss(goflare.MSELoss, data))
-		logrus.Infoln(goflare.NewConfusionMatrix([]string{"class0", "class1"}, actual, predictions))
+		logrus.Infof("%s data loss = %f\n", name, network.AvgLoss(goflare.CrossEntropyLoss, data))
+		logrus.Infoln(goflare.NewConfusionMatrix(classes, actual, predictions))
 		logrus.Infoln(network.Evaluate(data[0].Inputs), data[0].Outputs)
 	}
 
 	// testNetwork(trainData)
-	optimizer := goflare.NewOptimizer(&network, goflare.MSELoss, 0.001, 0)
+	optimizer := goflare.NewSGD(&network, goflare.CrossEntropyLoss, 0.001, 0)
+	if optimizerState != nil {
+		check(optimizer.LoadState(*optimizerState))
+	}
+	optimizer.SetScheduler(goflare.NewReduceOnPlateau("val_loss", 0.5, 1000), goflare.PerEpoch)
+	// The ReLU layers occasionally make the gradients explode
+	optimizer.SetGradientClipping(goflare.GradientClipping{GlobalNorm: 1})
 
 	trainer := goflare.NetworkTrainer{NbWorkers: 6}
 	loader := *goflare.NewDataLoader(trainData, len(trainData), true)
 	lastLog := time.Now()
 	lastEpochLog := 0
+	earlyStopping := goflare.NewEarlyStopping("val_loss", 10000)
+	earlyStopping.RestoreBestWeights = true
 
 	// tools.NewDebugServer(&network, testData, loader, optimizer).Run("localhost:5000")
 
-	for i := 0; i < 100000000; i++ {
-		runningLoss := trainer.Train(&network, &loader, optimizer)
-		// network.Learn(, optimizer)
-		if i%10 == 0 && (time.Since(lastLog) > 2*time.Second) {
-			logrus.Infof("#################### Epoch %d [%.1f epoch/s] ####################", i, 1000*float64(i-lastEpochLog)/float64(time.Since(lastLog).Milliseconds()))
-			lastLog = time.Now()
-			lastEpochLog = i
-			logrus.Infof("Train data loss = %f\n", runningLoss)
-			testNetwork("Train", trainData)
-			testNetwork("Test", testData)
-		}
+	_, err = trainer.Fit(&network, &loader, optimizer, goflare.FitOptions{
+		Epochs:     100000000,
+		Validation: testData,
+		Metrics:    []goflare.Metric{goflare.AccuracyMetric},
+		Callbacks: []goflare.Callback{
+			earlyStopping,
+			goflare.CallbackFuncs{
+				EpochEnd: func(ctx *goflare.FitContext, logs goflare.EpochLogs) {
+					i := ctx.Epoch
+					if i%10 == 0 && (time.Since(lastLog) > 2*time.Second) {
+						logrus.Infof("#################### Epoch %d [%.1f epoch/s] ####################", i, 1000*float64(i-lastEpochLog)/float64(time.Since(lastLog).Milliseconds()))
+						lastLog = time.Now()
+						lastEpochLog = i
+						logrus.Infof("Train data loss = %f, test data accuracy = %f, learn rate = %g, gradient norm = %g\n", logs["loss"], logs["val_accuracy"], logs["learn_rate"], optimizer.GradientNorm())
+						testNetwork("Train", trainData)
+						testNetwork("Test", testData)
+						if *modelPath != "" {
+							saveCheckpoint(*modelPath, &network, optimizer)
+						}
+					}
+				},
+			},
+		},
+	})
+	check(err)
+
+	logrus.Infof("Best epoch: %d", earlyStopping.BestEpoch())
+	testNetwork("Test", testData)
+	if *modelPath != "" {
+		saveCheckpoint(*modelPath, &network, optimizer)
 	}
+}
 
+func saveCheckpoint(path string, network *goflare.Network, optimizer goflare.Optimizer) {
+	f, err := os.Create(path)
+	check(err)
+	defer f.Close()
+	check(network.SaveCheckpoint(f, optimizer))
 }
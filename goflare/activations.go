@@ -2,21 +2,93 @@ package goflare
 
 import (
 	"encoding/json"
+	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 type ActivationFunc struct {
 	Name   string
 	F      func(float64) float64
 	FPrime func(float64) float64
+	// Optional, for activations coupling all the values of a layer (e.g. Softmax). When set, F and FPrime are not used.
+	VectorF func(values []float64) []float64
+	// Goes with VectorF: returns the derivative of the loss w.r.t. the values, given the values, their activation
+	// and the derivative of the loss w.r.t. the activation
+	VectorBackward func(values []float64, activated []float64, activatedGradient []float64) []float64
 }
 
-func (f *ActivationFunc) MarshalJSON() ([]byte, error) {
+func (f ActivationFunc) MarshalJSON() ([]byte, error) {
 	return json.Marshal(f.Name)
 }
 
-// Modifies the slice
+// Resolves the activation from its name, see RegisterActivation
+func (f *ActivationFunc) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	af, err := ActivationByName(name)
+	if err != nil {
+		return err
+	}
+	*f = af
+	return nil
+}
+
+var (
+	activationRegistry       = make(map[string]ActivationFunc)
+	activationFamilyRegistry = make(map[string]func(param float64) ActivationFunc)
+)
+
+func init() {
+	for _, af := range []ActivationFunc{Sigmoid, ReLU, Softmax, Tanh, SELU, GELU, Swish, Softplus, HardSigmoid, Linear} {
+		RegisterActivation(af)
+	}
+	activationRegistry["SiLU"] = Swish
+	activationRegistry["Identity"] = Linear
+	RegisterActivationFamily("LeakyReLU", NewLeakyReLU)
+	RegisterActivationFamily("ELU", NewELU)
+	// Without a parameter, the families resolve to their default activation
+	activationRegistry["LeakyReLU"] = LeakyReLU
+	activationRegistry["ELU"] = ELU
+}
+
+// Makes an activation resolvable by its name, typically to load a saved network using it.
+// NOTE: This is *NOT* thread safe, it is meant to be called in an init function
+func RegisterActivation(af ActivationFunc) {
+	activationRegistry[af.Name] = af
+}
+
+// Makes the activations parameterized by a float resolvable by their name, which must be "<family>(<param>)",
+// e.g. "LeakyReLU(0.01)". new must return activations named this way.
+// NOTE: This is *NOT* thread safe, it is meant to be called in an init function
+func RegisterActivationFamily(family string, new func(param float64) ActivationFunc) {
+	activationFamilyRegistry[family] = new
+}
+
+func ActivationByName(name string) (ActivationFunc, error) {
+	if af, ok := activationRegistry[name]; ok {
+		return af, nil
+	}
+	if family, param, ok := strings.Cut(name, "("); ok && strings.HasSuffix(param, ")") {
+		if new, ok := activationFamilyRegistry[family]; ok {
+			p, err := strconv.ParseFloat(strings.TrimSuffix(param, ")"), 64)
+			if err != nil {
+				return ActivationFunc{}, fmt.Errorf("invalid parameter in activation %q: %w", name, err)
+			}
+			return new(p), nil
+		}
+	}
+	return ActivationFunc{}, fmt.Errorf("unknown activation %q", name)
+}
+
+// Returns a new slice
 func (af *ActivationFunc) Vectorized(values []float64) []float64 {
+	if af.VectorF != nil {
+		return af.VectorF(values)
+	}
 	res := make([]float64, len(values))
 	for i := range values {
 		res[i] = af.F(values[i])
@@ -24,7 +96,7 @@ func (af *ActivationFunc) Vectorized(values []float64) []float64 {
 	return res
 }
 
-// Modifies the slice
+// Returns a new slice. Only for element-wise activations, see Backward for the general case
 func (af *ActivationFunc) PrimeVectorized(values []float64) []float64 {
 	res := make([]float64, len(values))
 	for i := range values {
@@ -33,27 +105,199 @@ func (af *ActivationFunc) PrimeVectorized(values []float64) []float64 {
 	return res
 }
 
+// Returns the derivative of the loss w.r.t. the values, given the values, their activation and the derivative of the
+// loss w.r.t. the activation. Works for both element-wise and vector activations.
+func (af *ActivationFunc) Backward(values []float64, activated []float64, activatedGradient []float64) []float64 {
+	if af.VectorBackward != nil {
+		return af.VectorBackward(values, activated, activatedGradient)
+	}
+	res := make([]float64, len(values))
+	for i := range values {
+		res[i] = activatedGradient[i] * af.FPrime(values[i])
+	}
+	return res
+}
+
 var (
 	Sigmoid = ActivationFunc{
-		"Sigmoid",
-		func(f float64) float64 {
+		Name: "Sigmoid",
+		F: func(f float64) float64 {
 			return 1 / (1 + math.Exp(-f))
 		},
-		func(f float64) float64 {
+		FPrime: func(f float64) float64 {
 			act := 1 / (1 + math.Exp(-f))
 			return act * (1 - act)
 		},
 	}
 	ReLU = ActivationFunc{
-		"ReLU",
-		func(f float64) float64 {
+		Name: "ReLU",
+		F: func(f float64) float64 {
 			return math.Max(0, f)
 		},
-		func(f float64) float64 {
+		FPrime: func(f float64) float64 {
 			if f > 0 {
 				return 1
 			}
 			return 0
 		},
 	}
+	// Turns the values into a probability distribution. Typically used on the last layer with CrossEntropyLoss.
+	Softmax = ActivationFunc{
+		Name: "Softmax",
+		VectorF: func(values []float64) []float64 {
+			// Shifting by the max doesn't change the result, but avoids overflowing exp
+			max := math.Inf(-1)
+			for _, v := range values {
+				if v > max {
+					max = v
+				}
+			}
+			res := make([]float64, len(values))
+			sum := float64(0)
+			for i := range values {
+				res[i] = math.Exp(values[i] - max)
+				sum += res[i]
+			}
+			for i := range res {
+				res[i] /= sum
+			}
+			return res
+		},
+		VectorBackward: func(values []float64, activated []float64, activatedGradient []float64) []float64 {
+			// dLoss/dValue_i = activated_i * (dLoss/dActivated_i - sum_j(dLoss/dActivated_j * activated_j))
+			dot := float64(0)
+			for j := range activated {
+				dot += activatedGradient[j] * activated[j]
+			}
+			res := make([]float64, len(values))
+			for i := range res {
+				res[i] = activated[i] * (activatedGradient[i] - dot)
+			}
+			return res
+		},
+	}
+	Tanh = ActivationFunc{
+		Name: "Tanh",
+		F:    math.Tanh,
+		FPrime: func(f float64) float64 {
+			act := math.Tanh(f)
+			return 1 - act*act
+		},
+	}
+	// Scaled ELU, self-normalizing with LeCun normal initialization, see https://arxiv.org/abs/1706.02515
+	SELU = ActivationFunc{
+		Name: "SELU",
+		F: func(f float64) float64 {
+			if f > 0 {
+				return seluScale * f
+			}
+			return seluScale * seluAlpha * (math.Exp(f) - 1)
+		},
+		FPrime: func(f float64) float64 {
+			if f > 0 {
+				return seluScale
+			}
+			return seluScale * seluAlpha * math.Exp(f)
+		},
+	}
+	// Gaussian Error Linear Unit: f * Φ(f), Φ being the standard normal CDF, see https://arxiv.org/abs/1606.08415
+	GELU = ActivationFunc{
+		Name: "GELU",
+		F: func(f float64) float64 {
+			return f * 0.5 * (1 + math.Erf(f/math.Sqrt2))
+		},
+		FPrime: func(f float64) float64 {
+			return 0.5*(1+math.Erf(f/math.Sqrt2)) + f*math.Exp(-f*f/2)/math.Sqrt(2*math.Pi)
+		},
+	}
+	// f * sigmoid(f), also known as SiLU
+	Swish = ActivationFunc{
+		Name: "Swish",
+		F: func(f float64) float64 {
+			return f / (1 + math.Exp(-f))
+		},
+		FPrime: func(f float64) float64 {
+			sig := 1 / (1 + math.Exp(-f))
+			return sig * (1 + f*(1-sig))
+		},
+	}
+	// Smooth approximation of ReLU: log(1 + exp(f))
+	Softplus = ActivationFunc{
+		Name: "Softplus",
+		F: func(f float64) float64 {
+			// Same as log(1 + exp(f)), without overflowing exp for large values
+			return math.Max(f, 0) + math.Log1p(math.Exp(-math.Abs(f)))
+		},
+		FPrime: func(f float64) float64 {
+			return 1 / (1 + math.Exp(-f))
+		},
+	}
+	// Piecewise linear approximation of Sigmoid: clamp(0.2 * f + 0.5, 0, 1)
+	HardSigmoid = ActivationFunc{
+		Name: "HardSigmoid",
+		F: func(f float64) float64 {
+			return math.Max(0, math.Min(1, 0.2*f+0.5))
+		},
+		FPrime: func(f float64) float64 {
+			if f > -2.5 && f < 2.5 {
+				return 0.2
+			}
+			return 0
+		},
+	}
+	// Leaves the values as is, also known as Identity. Typically used on the last layer for regressions.
+	Linear = ActivationFunc{
+		Name: "Linear",
+		F: func(f float64) float64 {
+			return f
+		},
+		FPrime: func(f float64) float64 {
+			return 1
+		},
+	}
+	LeakyReLU = NewLeakyReLU(0.01)
+	ELU       = NewELU(1)
+)
+
+const (
+	seluAlpha = 1.6732632423543772848170429916717
+	seluScale = 1.0507009873554804934193349852946
 )
+
+// Same as ReLU, but with a small slope alpha for negative values, so that their gradient is not 0
+func NewLeakyReLU(alpha float64) ActivationFunc {
+	return ActivationFunc{
+		Name: fmt.Sprintf("LeakyReLU(%g)", alpha),
+		F: func(f float64) float64 {
+			if f > 0 {
+				return f
+			}
+			return alpha * f
+		},
+		FPrime: func(f float64) float64 {
+			if f > 0 {
+				return 1
+			}
+			return alpha
+		},
+	}
+}
+
+// Exponential Linear Unit: f for positive values, alpha * (exp(f) - 1) for the negative ones
+func NewELU(alpha float64) ActivationFunc {
+	return ActivationFunc{
+		Name: fmt.Sprintf("ELU(%g)", alpha),
+		F: func(f float64) float64 {
+			if f > 0 {
+				return f
+			}
+			return alpha * (math.Exp(f) - 1)
+		},
+		FPrime: func(f float64) float64 {
+			if f > 0 {
+				return 1
+			}
+			return alpha * math.Exp(f)
+		},
+	}
+}
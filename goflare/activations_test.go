@@ -0,0 +1,105 @@
+package goflare
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jjunac/goflare/utils"
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestActivationsDerivatives(t *testing.T) {
+	assert := assert.New(t)
+	const h = 1e-6
+	for _, af := range []ActivationFunc{Sigmoid, ReLU, Tanh, LeakyReLU, NewLeakyReLU(0.3), ELU, NewELU(0.5), SELU, GELU, Swish, Softplus, HardSigmoid, Linear} {
+		// Avoiding the points where the derivative is not defined, e.g. 0 for ReLU
+		for _, x := range []float64{-3.1, -1.3, -0.4, 0.3, 1.7, 2.9} {
+			numerical := (af.F(x+h) - af.F(x-h)) / (2 * h)
+			assert.InDelta(numerical, af.FPrime(x), 1e-6, "%s'(%g)", af.Name, x)
+		}
+	}
+	assert.InDelta(0.0, Softplus.F(-1000), 1e-12)
+	assert.Equal(1000.0, Softplus.F(1000))
+}
+
+func TestVectorActivationsBackward(t *testing.T) {
+	assert := assert.New(t)
+	const h = 1e-6
+	activatedGradient := []float64{0.7, -1.2, 0.4, 2.1}
+	// Loss whose derivative w.r.t. the activation is activatedGradient
+	loss := func(af ActivationFunc, values []float64) float64 {
+		return mat.Dot(mat.NewVecDense(len(values), af.VectorF(values)), mat.NewVecDense(len(values), activatedGradient))
+	}
+	for _, af := range []ActivationFunc{Softmax} {
+		// The last values would overflow exp without the shift by the max
+		for _, values := range [][]float64{{0.3, -1.1, 2.4, 0}, {-3, -3, -3, -3}, {1000, 999, 1001, 998}} {
+			backward := af.VectorBackward(values, af.VectorF(values), activatedGradient)
+			for i := range values {
+				plus, minus := utils.CopySlice(values), utils.CopySlice(values)
+				plus[i] += h
+				minus[i] -= h
+				numerical := (loss(af, plus) - loss(af, minus)) / (2 * h)
+				assert.InDelta(numerical, backward[i], 1e-6, "%s, values %v, index %d", af.Name, values, i)
+			}
+		}
+	}
+}
+
+func TestActivationByName(t *testing.T) {
+	assert := assert.New(t)
+	for _, name := range []string{"Tanh", "LeakyReLU(0.01)", "LeakyReLU(0.3)", "ELU(1)", "SELU", "GELU", "Swish", "Softplus", "HardSigmoid", "Linear"} {
+		af, err := ActivationByName(name)
+		assert.NoError(err)
+		assert.Equal(name, af.Name)
+	}
+	af, err := ActivationByName("SiLU")
+	assert.NoError(err)
+	assert.Equal("Swish", af.Name)
+	af, err = ActivationByName("LeakyReLU")
+	assert.NoError(err)
+	assert.Equal("LeakyReLU(0.01)", af.Name)
+	af, err = ActivationByName("ELU")
+	assert.NoError(err)
+	assert.Equal("ELU(1)", af.Name)
+
+	// The parameter is kept when saving and loading
+	var loaded struct{ Activation ActivationFunc }
+	saved, err := json.Marshal(struct{ Activation ActivationFunc }{NewLeakyReLU(0.2)})
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(saved, &loaded))
+	assert.Equal(-0.4, loaded.Activation.F(-2))
+
+	_, err = ActivationByName("LeakyReLU(x)")
+	assert.ErrorContains(err, `invalid parameter in activation "LeakyReLU(x)"`)
+	_, err = ActivationByName("Foo(1)")
+	assert.EqualError(err, `unknown activation "Foo(1)"`)
+
+	t.Run("Custom", func(t *testing.T) {
+		RegisterActivation(ActivationFunc{Name: "Square", F: func(f float64) float64 { return f * f }})
+		defer delete(activationRegistry, "Square")
+		af, err := ActivationByName("Square")
+		assert.NoError(err)
+		assert.Equal(9.0, af.F(3))
+	})
+}
+
+func TestPReLULayer(t *testing.T) {
+	assert := assert.New(t)
+	l := NewPReLULayer(3)
+	l.Alphas[2] = 0.5
+	ld := LayerLearnData{}
+	assert.Equal([]float64{2, -0.25, -1}, l.EvaluateWithLearnData([]float64{2, -1, -2}, &ld))
+	gradients := NewParametersLike(l)
+	inputsGradient := l.Backward([]float64{1, 2, 3}, &ld, gradients)
+	assert.Equal([]float64{1, 0.5, 1.5}, inputsGradient)
+	assert.Equal([][]float64{{0, -2, -6}}, gradients)
+
+	// The batch version accumulates the same gradients
+	inputs := mat.NewDense(2, 3, []float64{2, -1, -2, 2, -1, -2})
+	bld := BatchLayerLearnData{}
+	l.EvaluateBatchWithLearnData(inputs, &bld)
+	batchGradients := NewParametersLike(l)
+	l.BackwardBatch(mat.NewDense(2, 3, []float64{1, 2, 3, 1, 2, 3}), &bld, batchGradients)
+	assert.Equal([][]float64{{0, -4, -12}}, batchGradients)
+}
@@ -0,0 +1,113 @@
+package goflare
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// Hooks called by NetworkTrainer.Fit
+type Callback interface {
+	// Called after each optimizer step, with the average loss of the batch
+	OnBatchEnd(ctx *FitContext, batch int, loss float64)
+	OnEpochEnd(ctx *FitContext, logs EpochLogs)
+	OnTrainEnd(ctx *FitContext)
+}
+
+// Adapter to use functions as a Callback. Nil functions are ignored.
+type CallbackFuncs struct {
+	BatchEnd func(ctx *FitContext, batch int, loss float64)
+	EpochEnd func(ctx *FitContext, logs EpochLogs)
+	TrainEnd func(ctx *FitContext)
+}
+
+func (c CallbackFuncs) OnBatchEnd(ctx *FitContext, batch int, loss float64) {
+	if c.BatchEnd != nil {
+		c.BatchEnd(ctx, batch, loss)
+	}
+}
+
+func (c CallbackFuncs) OnEpochEnd(ctx *FitContext, logs EpochLogs) {
+	if c.EpochEnd != nil {
+		c.EpochEnd(ctx, logs)
+	}
+}
+
+func (c CallbackFuncs) OnTrainEnd(ctx *FitContext) {
+	if c.TrainEnd != nil {
+		c.TrainEnd(ctx)
+	}
+}
+
+// Stops the training when the monitored metric stops improving
+type EarlyStopping struct {
+	// Name of the metric in the EpochLogs, e.g. "val_loss"
+	Monitor string
+	// Whether a higher value is better (e.g. for "val_accuracy")
+	Maximize bool
+	// Minimum change to be considered as an improvement
+	MinDelta float64
+	// Number of epochs without improvement before stopping
+	Patience int
+	// Restores the parameters of the best epoch at the end of the training
+	RestoreBestWeights bool
+
+	// Whether best was set, so that the struct can be built without NewEarlyStopping
+	seen        bool
+	best        float64
+	bestEpoch   int
+	wait        int
+	bestNetwork *Network
+}
+
+func NewEarlyStopping(monitor string, patience int) *EarlyStopping {
+	return &EarlyStopping{
+		Monitor:  monitor,
+		Patience: patience,
+	}
+}
+
+// Epoch of the best value of the monitored metric, starting at 0
+func (es *EarlyStopping) BestEpoch() int {
+	return es.bestEpoch
+}
+
+func (es *EarlyStopping) OnBatchEnd(ctx *FitContext, batch int, loss float64) {}
+
+func (es *EarlyStopping) OnEpochEnd(ctx *FitContext, logs EpochLogs) {
+	value, ok := logs[es.Monitor]
+	if !ok {
+		logrus.Warnf("EarlyStopping: metric %s is not available", es.Monitor)
+		return
+	}
+	if es.Maximize {
+		value = -value
+	}
+	if !es.seen || value < es.best-es.MinDelta {
+		es.seen = true
+		es.best = value
+		es.bestEpoch = ctx.Epoch
+		es.wait = 0
+		if es.RestoreBestWeights {
+			bestNetwork := CopyNetwork(ctx.Network)
+			es.bestNetwork = &bestNetwork
+		}
+		return
+	}
+	es.wait++
+	if es.wait > es.Patience {
+		ctx.StopTraining = true
+	}
+}
+
+func (es *EarlyStopping) OnTrainEnd(ctx *FitContext) {
+	if es.bestNetwork == nil {
+		return
+	}
+	// Copying the values in place, so that the layers referenced elsewhere (e.g. by the caller) are restored too
+	for i := range ctx.Network.Layers {
+		params := ctx.Network.Layers[i].Parameters()
+		bestParams := es.bestNetwork.Layers[i].Parameters()
+		for j := range params {
+			copy(params[j], bestParams[j])
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package goflare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEarlyStopping(t *testing.T) {
+	assert := assert.New(t)
+	// Built with the constructor or as a struct literal
+	for _, es := range []*EarlyStopping{NewEarlyStopping("val_loss", 2), {Monitor: "val_loss", Patience: 2}} {
+		network := NewNetwork([]Layer{NewDenseLayer(2, 1, Sigmoid)})
+		ctx := &FitContext{Network: &network, History: &History{}}
+
+		es.RestoreBestWeights = true
+		var bestWeights []float64
+		for i, valLoss := range []float64{0.5, 0.3, 0.4, 0.35, 0.2, 0.25, 0.3, 0.3, 0.1} {
+			ctx.Epoch = i
+			network.Layers[0].(*DenseLayer).SetWeight(0, 0, float64(i))
+			if valLoss == 0.2 {
+				bestWeights = network.Layers[0].Copy().(*DenseLayer).Weights
+			}
+			es.OnEpochEnd(ctx, EpochLogs{"val_loss": valLoss})
+			if ctx.StopTraining {
+				break
+			}
+		}
+		es.OnTrainEnd(ctx)
+
+		assert.True(ctx.StopTraining)
+		assert.Equal(7, ctx.Epoch)
+		assert.Equal(4, es.BestEpoch())
+		assert.Equal(bestWeights, network.Layers[0].(*DenseLayer).Weights)
+	}
+}
+
+func TestFit(t *testing.T) {
+	assert := assert.New(t)
+	network := NewNetwork([]Layer{NewDenseLayer(2, 2, Softmax)})
+	data := Dataset{{Inputs: []float64{0, 1}, Outputs: []float64{1, 0}}, {Inputs: []float64{1, 0}, Outputs: []float64{0, 1}}}
+	trainer := NetworkTrainer{NbWorkers: 1}
+	nbBatches := 0
+
+	history, err := trainer.Fit(&network, NewDataLoader(data, 1, false), NewSGD(&network, CrossEntropyLoss, 0.5, 0), FitOptions{
+		Epochs:     50,
+		Validation: data,
+		Metrics:    []Metric{AccuracyMetric},
+		Callbacks:  []Callback{CallbackFuncs{BatchEnd: func(ctx *FitContext, batch int, loss float64) { nbBatches++ }}},
+	})
+
+	assert.NoError(err)
+	assert.Equal(100, nbBatches)
+	assert.Len(history.Epochs, 50)
+	assert.Contains(history.Epochs[49], "loss")
+	assert.Contains(history.Epochs[49], "val_loss")
+	assert.Equal(float64(1), history.Epochs[49]["val_accuracy"])
+	assert.Less(history.Epochs[49]["val_loss"], history.Epochs[0]["val_loss"])
+
+	t.Run("Empty epoch", func(t *testing.T) {
+		history, err := trainer.Fit(&network, NewDataLoader(data, 3, false, DropLast()), NewSGD(&network, CrossEntropyLoss, 0.5, 0), FitOptions{Epochs: 2})
+		assert.EqualError(err, "cannot train epoch 0: no data points")
+		assert.Empty(history.Epochs)
+	})
+}
@@ -1,11 +1,15 @@
 package goflare
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"time"
 
 	"github.com/jjunac/goflare/utils"
+
+	"gonum.org/v1/gonum/mat"
 )
 
 type Dataset []DataPoint
@@ -13,22 +17,126 @@ type Dataset []DataPoint
 type DataPoint struct {
 	Inputs  []float64
 	Outputs []float64
+	// Multiplies the loss of the data point, and so its gradients, when trained with a DataLoader using
+	// WithSampleWeights. A weight of 0 masks the data point. Ignored otherwise.
+	Weight float64
+}
+
+// Returns the weight of each data point if weighted, nil otherwise (all 1), see WithSampleWeights
+func (d Dataset) sampleWeights(weighted bool) []float64 {
+	if !weighted {
+		return nil
+	}
+	return utils.InitSlice(len(d), func(i int) float64 { return d[i].Weight })
+}
+
+// Returns the weight i, 1 if there are no weights
+func weightAt(weights []float64, i int) float64 {
+	if weights == nil {
+		return 1
+	}
+	return weights[i]
+}
+
+// Returns the inputs and the outputs as matrices, with one row per data point
+func (d Dataset) Matrices() (inputs *mat.Dense, outputs *mat.Dense) {
+	if len(d) == 0 {
+		return &mat.Dense{}, &mat.Dense{}
+	}
+	inputs = mat.NewDense(len(d), len(d[0].Inputs), nil)
+	outputs = mat.NewDense(len(d), len(d[0].Outputs), nil)
+	for i := range d {
+		inputs.SetRow(i, d[i].Inputs)
+		outputs.SetRow(i, d[i].Outputs)
+	}
+	return
 }
 
 type DataStream struct {
-	data [][]any
+	data    [][]any
+	ignored utils.Set[int]
+	// Names of the columns, if known (e.g. from the header of a CSV)
+	columns []string
 }
 
 func NewDataStream(capacity int) *DataStream {
 	return &DataStream{
-		make([][]any, 0, capacity),
+		data:    make([][]any, 0, capacity),
+		ignored: utils.NewSet[int](),
+	}
+}
+
+// Iterates over the rows in memory, e.g. for DataPipeline.FitIterator. The rows are shared with the stream.
+func (ds *DataStream) Rows() RowIterator {
+	return &sliceRowIterator{ds.data, 0}
+}
+
+type sliceRowIterator struct {
+	rows [][]any
+	next int
+}
+
+func (it *sliceRowIterator) Next() ([]any, error) {
+	if it.next >= len(it.rows) {
+		return nil, io.EOF
+	}
+	it.next++
+	return it.rows[it.next-1], nil
+}
+
+// Names the columns, so that they can be referenced by name (see Schema)
+func (ds *DataStream) SetColumns(names []string) error {
+	seen := utils.NewSet[string]()
+	for _, name := range names {
+		if seen.Contains(name) {
+			return fmt.Errorf("duplicate column %q", name)
+		}
+		seen.Add(name)
+	}
+	if len(ds.data) > 0 && len(ds.data[0]) != len(names) {
+		return fmt.Errorf("%d column names for %d columns", len(names), len(ds.data[0]))
 	}
+	ds.columns = names
+	return nil
 }
 
+// Returns the columns of the stream, with their type inferred from the current values.
+// A column holding both numeric and categorical values is categorical. The unnamed columns have an empty name.
+func (ds *DataStream) Schema() Schema {
+	nbCols := len(ds.columns)
+	if len(ds.data) > 0 {
+		nbCols = len(ds.data[0])
+	}
+	schema := make(Schema, nbCols)
+	for col := range schema {
+		if col < len(ds.columns) {
+			schema[col].Name = ds.columns[col]
+		}
+		for row := range ds.data {
+			if t := valueColumnType(ds.data[row][col]); t > schema[col].Type {
+				schema[col].Type = t
+			}
+			if schema[col].Type == ColumnCategorical {
+				break
+			}
+		}
+	}
+	return schema
+}
+
+// Applies the pipeline on the data. The columns it ignores will be left out by ToDataset, and the rows it drops are
+// removed from the stream.
 func (ds *DataStream) ApplyPipeline(pipeline *DataPipeline) error {
-	return pipeline.Apply(ds.data)
+	for col := range pipeline.ignored {
+		ds.ignored.Add(col)
+	}
+	var err error
+	ds.data, err = pipeline.Apply(ds.data)
+	return err
 }
 
+// Converts the rows into data points, the targetCols being the outputs and the other non-ignored columns the inputs.
+// The values must be float64, or []float64 for the columns expanded into several ones (see PPOneHotEncoder).
 // TODO: Find something better to differentiate inputs and targets
 func (ds *DataStream) ToDataset(targetCols []int) (dataset Dataset, err error) {
 	dataset = make(Dataset, len(ds.data))
@@ -36,85 +144,251 @@ func (ds *DataStream) ToDataset(targetCols []int) (dataset Dataset, err error) {
 	var inputCols []int
 	if len(ds.data) > 0 {
 		targets := utils.NewSetFromSlice(targetCols)
-		inputCols = make([]int, 0, len(ds.data[0])-len(targets))
+		inputCols = make([]int, 0, len(ds.data[0]))
 		for i := range ds.data[0] {
-			if !targets.Contains(i) {
+			if !targets.Contains(i) && !ds.ignored.Contains(i) {
 				inputCols = append(inputCols, i)
 			}
 		}
 	}
 
 	for row, d := range ds.data {
-		columnsToFloat64Slice := func(cols []int) (values []float64, err error) {
-			values = make([]float64, len(cols))
-			for i, col := range cols {
-				if f, ok := d[col].(float64); ok {
-					values[i] = f
-				} else {
-					err = fmt.Errorf("value at row %d, col %d is not a float", row, col)
-					return
-				}
-			}
+		if dataset[row], err = rowToDataPoint(d, row, inputCols, targetCols); err != nil {
 			return
 		}
-		dataset[row].Inputs, err = columnsToFloat64Slice(inputCols)
-		if err != nil {
-			return
-		}
-		dataset[row].Outputs, err = columnsToFloat64Slice(targetCols)
-		if err != nil {
-			return
+	}
+	return
+}
+
+func rowToDataPoint(d []any, row int, inputCols []int, targetCols []int) (point DataPoint, err error) {
+	columnsToFloat64Slice := func(cols []int) (values []float64, err error) {
+		values = make([]float64, 0, len(cols))
+		for _, col := range cols {
+			switch v := d[col].(type) {
+			case float64:
+				values = append(values, v)
+			case []float64:
+				// Expanded column, e.g. by a one-hot encoder
+				values = append(values, v...)
+			case nil:
+				err = fmt.Errorf("value at row %d, col %d is missing", row, col)
+				return
+			default:
+				err = fmt.Errorf("value at row %d, col %d is not a float", row, col)
+				return
+			}
 		}
+		return
+	}
+	if point.Inputs, err = columnsToFloat64Slice(inputCols); err != nil {
+		return
 	}
+	point.Outputs, err = columnsToFloat64Slice(targetCols)
 	return
 }
 
+// Same as ToDataset, with the target columns referenced by name
+func (ds *DataStream) ToDatasetByName(targets ...string) (Dataset, error) {
+	targetCols, err := ds.Schema().Indices(targets)
+	if err != nil {
+		return nil, err
+	}
+	return ds.ToDataset(targetCols)
+}
+
 type DataLoader struct {
-	dataset   Dataset
+	dataset Dataset
+	// Alternatively, opens the rows of each epoch, converted into data points by the pipeline, see NewStreamDataLoader
+	open      func() (RowIterator, error)
+	pipeline  *DataPipeline
 	batchSize int
 	shuffle   bool
+	// Chooses the data points of each epoch, nil to take them all in order (or shuffled)
+	sampler  Sampler
+	dropLast bool
+	// Whether the loss of each data point is multiplied by its weight, see WithSampleWeights
+	weighted bool
+	rng      *rand.Rand
+	// Error which ended the last epoch early, see Err
+	err error
+}
+
+type DataLoaderOption func(dl *DataLoader)
+
+// Sets how the data points of each epoch are chosen, e.g. to rebalance the classes. Replaces the shuffle flag.
+func WithSampler(sampler Sampler) DataLoaderOption {
+	return func(dl *DataLoader) {
+		dl.sampler = sampler
+	}
+}
+
+// Skips the last batch of each epoch if it is smaller than the others
+func DropLast() DataLoaderOption {
+	return func(dl *DataLoader) {
+		dl.dropLast = true
+	}
+}
+
+// Multiplies the loss of each data point, and so its gradients, by its weight (see DataPoint.Weight) when training
+func WithSampleWeights() DataLoaderOption {
+	return func(dl *DataLoader) {
+		dl.weighted = true
+	}
 }
 
-func NewDataLoader(dataset Dataset, batchSize int, shuffle bool) *DataLoader {
+// Sets the random source used to shuffle and sample the data points, for reproducible runs.
+// NOTE: rand.Rand is *NOT* thread safe, the loaders sharing it must not be iterated in parallel
+func WithSamplingSource(rng *rand.Rand) DataLoaderOption {
+	return func(dl *DataLoader) {
+		dl.rng = rng
+	}
+}
+
+func NewDataLoader(dataset Dataset, batchSize int, shuffle bool, options ...DataLoaderOption) *DataLoader {
 	dl := &DataLoader{
-		dataset,
-		batchSize,
-		shuffle,
+		dataset:   dataset,
+		batchSize: batchSize,
+		shuffle:   shuffle,
+	}
+	for i := range options {
+		options[i](dl)
+	}
+	if dl.sampler == nil && dl.shuffle {
+		dl.sampler = RandomSampler{}
+	}
+	if dl.rng == nil {
+		dl.rng = rand.New(rand.NewSource(rand.Int63()))
 	}
 	return dl
 }
 
+// Streams the data points of each epoch from the rows returned by open, transformed by the already fitted pipeline
+// (see DataPipeline.FitIterator), so that only a batch of them is in memory at once. The rows are opened once per epoch
+// and read in order, the iterators implementing io.Closer being closed at the end of it. A read or processing error
+// ends the epoch early, see Err.
+// NOTE: The samplers need the whole dataset, WithSampler can't be used here
+func NewStreamDataLoader(open func() (RowIterator, error), pipeline *DataPipeline, batchSize int, options ...DataLoaderOption) (*DataLoader, error) {
+	dl := NewDataLoader(nil, batchSize, false, options...)
+	if dl.sampler != nil {
+		return nil, errors.New("cannot sample the data points of a stream")
+	}
+	dl.open = open
+	dl.pipeline = pipeline
+	return dl, nil
+}
+
+// Size of the dataset, 0 if streamed. The number of data points of an epoch can differ, depending on the sampler and
+// DropLast.
 func (dl *DataLoader) Len() int {
 	return len(dl.dataset)
 }
 
+// Returns the batches of an epoch. Prefer Iter, which doesn't build all of them at once.
 func (dl *DataLoader) Batches() []Dataset {
-	dataset := dl.dataset
-	if dl.shuffle {
-		dataset = make(Dataset, len(dl.dataset))
-		copy(dataset, dl.dataset)
-		rand.Shuffle(len(dataset), func(i, j int) {
-			tmp := dataset[i]
-			dataset[i] = dataset[j]
-			dataset[j] = tmp
-		})
-	}
-
-	batches := make([]Dataset, 0, (len(dataset)+dl.batchSize-1)/dl.batchSize)
-	lowerBound := 0
-	end := false
-	for !end {
-		upperBound := lowerBound + dl.batchSize
-		if upperBound > len(dataset) {
-			upperBound = len(dataset)
-			end = true
-		}
-		batches = append(batches, dataset[lowerBound:upperBound])
-		lowerBound = upperBound
+	batches := make([]Dataset, 0, (len(dl.dataset)+dl.batchSize-1)/dl.batchSize)
+	it := dl.Iter()
+	for batch, ok := it.Next(); ok; batch, ok = it.Next() {
+		batches = append(batches, utils.CopySlice(batch))
 	}
 	return batches
 }
 
+// Starts a new epoch, sampling the data points if needed. If the sampler fails, the epoch has no batch, see Err.
+func (dl *DataLoader) Iter() *BatchIterator {
+	dl.err = nil
+	it := &BatchIterator{dl: dl, n: len(dl.dataset)}
+	if dl.open != nil {
+		rows, err := dl.open()
+		if err != nil {
+			dl.err = fmt.Errorf("cannot open rows: %w", err)
+			return it
+		}
+		it.rows = rows
+		it.points = dl.pipeline.dataPoints(rows)
+		it.batch = make(Dataset, 0, dl.batchSize)
+	} else if dl.sampler != nil {
+		indices, err := dl.sampler.Indices(dl.dataset, dl.rng)
+		if err != nil {
+			dl.err = fmt.Errorf("cannot sample the data points: %w", err)
+			return &BatchIterator{dl: dl}
+		}
+		it.indices = indices
+		it.n = len(it.indices)
+		it.batch = make(Dataset, dl.batchSize)
+	}
+	return it
+}
+
+// Returns the error which ended the last epoch early, nil if it went through. Like bufio.Scanner, it is meant to be
+// checked once the batches are consumed, e.g. after NetworkTrainer.Train.
+func (dl *DataLoader) Err() error {
+	return dl.err
+}
+
+// Iterates over the batches of an epoch, see DataLoader.Iter
+type BatchIterator struct {
+	dl *DataLoader
+	// Data points of the epoch, nil to take the dataset in order
+	indices []int
+	// Set when streaming, until the end of the rows
+	rows   RowIterator
+	points *dataPointIterator
+	n      int
+	next   int
+	// Reused between the batches, to avoid allocating them
+	batch Dataset
+}
+
+// Returns the next batch, or false at the end of the epoch.
+// NOTE: the batch is only valid until the next call, since its memory is reused
+func (it *BatchIterator) Next() (Dataset, bool) {
+	if it.points != nil {
+		return it.nextStreamed()
+	}
+	size := it.dl.batchSize
+	if it.next+size > it.n {
+		size = it.n - it.next
+	}
+	if size <= 0 || (it.dl.dropLast && size < it.dl.batchSize) {
+		return nil, false
+	}
+	lowerBound := it.next
+	it.next += size
+	if it.indices == nil {
+		// Sharing the dataset, without copying it
+		return it.dl.dataset[lowerBound:it.next], true
+	}
+	batch := it.batch[:size]
+	for i := range batch {
+		batch[i] = it.dl.dataset[it.indices[lowerBound+i]]
+	}
+	return batch, true
+}
+
+// Reads the data points of the next batch, closing the rows once they are all read
+func (it *BatchIterator) nextStreamed() (Dataset, bool) {
+	batch := it.batch[:0]
+	for len(batch) < it.dl.batchSize {
+		point, err := it.points.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			it.dl.err = err
+			break
+		}
+		batch = append(batch, point)
+	}
+	if len(batch) < it.dl.batchSize {
+		closeRows(it.rows)
+		it.rows, it.points = nil, nil
+		if it.dl.err != nil || len(batch) == 0 || it.dl.dropLast {
+			return nil, false
+		}
+	}
+	return batch, true
+}
+
 // Little shortcut for RandomSplit with 2 datasets
 func RandomSplit2[T any](dataset []T, proportions ...float64) ([]T, []T) {
 	res := RandomSplit(dataset, proportions...)
@@ -1,6 +1,7 @@
 package goflare
 
 import (
+	"bufio"
 	"encoding/csv"
 	"fmt"
 	"io"
@@ -9,32 +10,172 @@ import (
 	"github.com/jjunac/goflare/utils"
 )
 
-func CSVDataStream(path string) (*DataStream, error) {
+// Iterates lazily over rows, e.g. read from a file, so that they don't have to be all in memory.
+// Next returns io.EOF once there are no more rows.
+type RowIterator interface {
+	Next() ([]any, error)
+}
+
+// Closes the iterators implementing io.Closer, e.g. the ones reading a file
+func closeRows(it RowIterator) {
+	if closer, ok := it.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+type CSVOptions struct {
+	// Field delimiter, ',' by default
+	Comma rune
+	// Quoting character, '"' by default. Must be an ASCII character.
+	Quote rune
+	// Lines starting with this character are skipped, none by default
+	Comment rune
+	// Whether the first line is a row instead of the column names
+	NoHeader         bool
+	LazyQuotes       bool
+	TrimLeadingSpace bool
+}
+
+// Reads a CSV row by row, see RowIterator. The values are strings.
+type CSVReader struct {
+	r       *csv.Reader
+	closer  io.Closer
+	columns []string
+	// Swapped with '"' in the input, then back in the values, since encoding/csv only supports '"'
+	quote byte
+}
+
+// Reads a CSV from any reader, e.g. os.Stdin or a gzip.Reader. The header, if any, is read immediately.
+func NewCSVReader(r io.Reader, options CSVOptions) (*CSVReader, error) {
+	cr := &CSVReader{quote: '"'}
+	if options.Quote != 0 && options.Quote != '"' {
+		if options.Quote >= 0x80 {
+			return nil, fmt.Errorf("unsupported quote %q: must be an ASCII character", options.Quote)
+		}
+		cr.quote = byte(options.Quote)
+		r = &byteSwapReader{bufio.NewReader(r), cr.quote, '"'}
+	}
+	cr.r = csv.NewReader(r)
+	if options.Comma != 0 {
+		cr.r.Comma = options.Comma
+	}
+	cr.r.Comment = options.Comment
+	cr.r.LazyQuotes = options.LazyQuotes
+	cr.r.TrimLeadingSpace = options.TrimLeadingSpace
+	cr.r.ReuseRecord = true
+
+	if !options.NoHeader {
+		header, err := cr.r.Read()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read csv header: %w", err)
+		}
+		cr.columns = cr.unswap(utils.CopySlice(header))
+	}
+	return cr, nil
+}
+
+// Opens a CSV file, which is closed by CSVReader.Close
+func OpenCSV(path string, options CSVOptions) (*CSVReader, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("cannot open %s: %w", path, err)
 	}
+	cr, err := NewCSVReader(f, options)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot read csv %s: %w", path, err)
+	}
+	cr.closer = f
+	return cr, nil
+}
 
-	r := csv.NewReader(f)
-	ds := NewDataStream(0)
+// Names of the columns, read from the header. Nil if there is none.
+func (cr *CSVReader) Columns() []string {
+	return cr.columns
+}
 
-	// Skip header
-	_, err = r.Read()
+func (cr *CSVReader) Next() ([]any, error) {
+	record, err := cr.r.Read()
 	if err != nil {
-		return nil, fmt.Errorf("cannot read csv %s: %w", path, err)
+		return nil, err
 	}
+	record = cr.unswap(record)
+	return utils.InitSlice(len(record), func(i int) any { return record[i] }), nil
+}
 
-	// Read each rows
+// Reads all the remaining rows into a DataStream, named after the header
+func (cr *CSVReader) ReadAll() (*DataStream, error) {
+	ds := NewDataStream(0)
 	for {
-		row, err := r.Read()
+		row, err := cr.Next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("cannot read csv %s: %w", path, err)
+			return nil, err
+		}
+		ds.data = append(ds.data, row)
+	}
+	if cr.columns != nil {
+		if err := ds.SetColumns(cr.columns); err != nil {
+			return nil, err
+		}
+	}
+	return ds, nil
+}
+
+// Closes the underlying file, if opened by OpenCSV
+func (cr *CSVReader) Close() error {
+	if cr.closer == nil {
+		return nil
+	}
+	return cr.closer.Close()
+}
+
+func (cr *CSVReader) unswap(record []string) []string {
+	if cr.quote == '"' {
+		return record
+	}
+	for i := range record {
+		b := []byte(record[i])
+		swapBytes(b, cr.quote, '"')
+		record[i] = string(b)
+	}
+	return record
+}
+
+// Swaps 2 bytes in everything read
+type byteSwapReader struct {
+	r    io.Reader
+	a, b byte
+}
+
+func (sr *byteSwapReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	swapBytes(p[:n], sr.a, sr.b)
+	return n, err
+}
+
+func swapBytes(p []byte, a, b byte) {
+	for i := range p {
+		if p[i] == a {
+			p[i] = b
+		} else if p[i] == b {
+			p[i] = a
 		}
-		ds.data = append(ds.data, utils.InitSlice(len(row), func(i int) any { return row[i] }))
 	}
+}
 
+// Reads a whole CSV file, with a header, into memory. See OpenCSV to read it row by row instead.
+func CSVDataStream(path string) (*DataStream, error) {
+	cr, err := OpenCSV(path, CSVOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer cr.Close()
+	ds, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read csv %s: %w", path, err)
+	}
 	return ds, nil
 }
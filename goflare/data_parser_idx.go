@@ -0,0 +1,179 @@
+package goflare
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Multi-dimensional array read from an IDX file, the format of MNIST and Fashion-MNIST
+type IDXArray struct {
+	// Unsigned bytes (0x08), signed bytes (0x09), int16 (0x0B), int32 (0x0C), float32 (0x0D) or float64 (0x0E)
+	Type byte
+	Dims []int
+	// Values stored row-major, i.e. the last dimension varies the fastest
+	Data []float64
+}
+
+// Size of a value of each IDX type, in bytes
+var idxTypeSizes = map[byte]int{0x08: 1, 0x09: 1, 0x0B: 2, 0x0C: 4, 0x0D: 4, 0x0E: 8}
+
+// Number of values allocated before reading the data of an IDX array, more being allocated as they are read
+const idxInitialCap = 1 << 20
+
+// Reads an IDX array, see http://yann.lecun.com/exdb/mnist/
+func ReadIDX(r io.Reader) (*IDXArray, error) {
+	br := bufio.NewReader(r)
+	var magic [4]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return nil, fmt.Errorf("cannot read idx header: %w", err)
+	}
+	size, ok := idxTypeSizes[magic[2]]
+	if magic[0] != 0 || magic[1] != 0 || !ok {
+		return nil, fmt.Errorf("cannot read idx: invalid magic number %x", magic)
+	}
+	a := &IDXArray{Type: magic[2], Dims: make([]int, magic[3])}
+	total := 1
+	for i := range a.Dims {
+		var dim uint32
+		if err := binary.Read(br, binary.BigEndian, &dim); err != nil {
+			return nil, fmt.Errorf("cannot read idx header: %w", err)
+		}
+		if dim == 0 {
+			return nil, fmt.Errorf("cannot read idx: dimension %d is 0", i)
+		}
+		if total > math.MaxInt/size/int(dim) {
+			return nil, fmt.Errorf("cannot read idx: dimension %d of size %d is too large", i, dim)
+		}
+		a.Dims[i] = int(dim)
+		total *= int(dim)
+	}
+
+	// The dimensions come from the file: the data grows as it is read, instead of being allocated up front, so that a
+	// corrupted header fails on the missing values rather than exhausting the memory
+	initialCap := total
+	if initialCap > idxInitialCap {
+		initialCap = idxInitialCap
+	}
+	a.Data = make([]float64, 0, initialCap)
+	buf := make([]byte, size)
+	for i := 0; i < total; i++ {
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, fmt.Errorf("cannot read idx value %d/%d: %w", i, total, err)
+		}
+		var v float64
+		switch a.Type {
+		case 0x08:
+			v = float64(buf[0])
+		case 0x09:
+			v = float64(int8(buf[0]))
+		case 0x0B:
+			v = float64(int16(binary.BigEndian.Uint16(buf)))
+		case 0x0C:
+			v = float64(int32(binary.BigEndian.Uint32(buf)))
+		case 0x0D:
+			v = float64(math.Float32frombits(binary.BigEndian.Uint32(buf)))
+		case 0x0E:
+			v = math.Float64frombits(binary.BigEndian.Uint64(buf))
+		}
+		a.Data = append(a.Data, v)
+	}
+	return a, nil
+}
+
+// Builds a dataset from IDX images (N x ... dimensions) and labels (N), e.g. the MNIST files.
+// Each image is flattened into the inputs, the unsigned bytes being scaled to [0, 1], and the labels are one-hot
+// encoded into nbClasses outputs.
+func IDXDataset(images io.Reader, labels io.Reader, nbClasses int) (Dataset, error) {
+	imagesArray, err := ReadIDX(images)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read images: %w", err)
+	}
+	labelsArray, err := ReadIDX(labels)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read labels: %w", err)
+	}
+	if len(imagesArray.Dims) == 0 || len(labelsArray.Dims) != 1 || imagesArray.Dims[0] != labelsArray.Dims[0] {
+		return nil, fmt.Errorf("images of dimensions %v do not match labels of dimensions %v", imagesArray.Dims, labelsArray.Dims)
+	}
+
+	n := imagesArray.Dims[0]
+	imageSize := 0
+	if n > 0 {
+		imageSize = len(imagesArray.Data) / n
+	}
+	scale := float64(1)
+	if imagesArray.Type == 0x08 {
+		scale = 255
+	}
+	dataset := make(Dataset, n)
+	for i := range dataset {
+		label := int(labelsArray.Data[i])
+		if label < 0 || label >= nbClasses || float64(label) != labelsArray.Data[i] {
+			return nil, fmt.Errorf("label %g of image %d is not in [0, %d)", labelsArray.Data[i], i, nbClasses)
+		}
+		// Sharing the data of the array, instead of copying it
+		dataset[i].Inputs = imagesArray.Data[i*imageSize : (i+1)*imageSize : (i+1)*imageSize]
+		for j := range dataset[i].Inputs {
+			dataset[i].Inputs[j] /= scale
+		}
+		dataset[i].Outputs = make([]float64, nbClasses)
+		dataset[i].Outputs[label] = 1
+	}
+	return dataset, nil
+}
+
+// Same as IDXDataset, from files which can be gzipped (e.g. train-images-idx3-ubyte.gz)
+func IDXFileDataset(imagesPath string, labelsPath string, nbClasses int) (Dataset, error) {
+	images, err := openMaybeGzipped(imagesPath)
+	if err != nil {
+		return nil, err
+	}
+	defer images.Close()
+	labels, err := openMaybeGzipped(labelsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer labels.Close()
+	return IDXDataset(images, labels, nbClasses)
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (gf *gzipFile) Close() error {
+	err := gf.Reader.Close()
+	if fErr := gf.f.Close(); err == nil {
+		err = fErr
+	}
+	return err
+}
+
+// Opens a file, decompressing it if it starts with the gzip magic number
+func openMaybeGzipped(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %w", path, err)
+	}
+	var magic [2]byte
+	n, _ := io.ReadFull(f, magic[:])
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	if n < 2 || magic != [2]byte{0x1f, 0x8b} {
+		return f, nil
+	}
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	return &gzipFile{gr, f}, nil
+}
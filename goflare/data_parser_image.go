@@ -0,0 +1,121 @@
+package goflare
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type ImageFolderOptions struct {
+	// Size the images are resized to (nearest neighbour). By default, the size of the first image, all the images
+	// having to be of the same size.
+	Width  int
+	Height int
+	// Whether the images are converted to a single gray channel, instead of 3 RGB channels
+	Grayscale bool
+}
+
+// Builds a dataset from the PNG and JPEG images in the subdirectories of root, one per class:
+// root/cat/1.png, root/dog/2.jpg... The files with another extension are skipped.
+// The inputs are the pixels, row by row, each channel scaled to [0, 1]. The outputs are the one-hot encoded classes,
+// which are returned in order, the subdirectories being sorted by name.
+func ImageFolderDataset(root string, options ImageFolderOptions) (Dataset, []string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read %s: %w", root, err)
+	}
+	classes := make([]string, 0)
+	for _, e := range entries {
+		if e.IsDir() {
+			classes = append(classes, e.Name())
+		}
+	}
+	sort.Strings(classes)
+
+	resize := options.Width != 0 || options.Height != 0
+	if resize && (options.Width <= 0 || options.Height <= 0) {
+		return nil, nil, fmt.Errorf("invalid image size %dx%d", options.Width, options.Height)
+	}
+	dataset := make(Dataset, 0)
+	for class, name := range classes {
+		dir := filepath.Join(root, name)
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot read %s: %w", dir, err)
+		}
+		for _, f := range files {
+			switch strings.ToLower(filepath.Ext(f.Name())) {
+			case ".png", ".jpg", ".jpeg":
+			default:
+				continue
+			}
+			path := filepath.Join(dir, f.Name())
+			img, err := decodeImageFile(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !resize {
+				if options.Width == 0 {
+					options.Width, options.Height = img.Bounds().Dx(), img.Bounds().Dy()
+				} else if img.Bounds().Dx() != options.Width || img.Bounds().Dy() != options.Height {
+					return nil, nil, fmt.Errorf("cannot load %s: size %dx%d differs from the previous images %dx%d", path, img.Bounds().Dx(), img.Bounds().Dy(), options.Width, options.Height)
+				}
+			}
+			inputs, err := imagePixels(img, options)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot load %s: %w", path, err)
+			}
+			outputs := make([]float64, len(classes))
+			outputs[class] = 1
+			dataset = append(dataset, DataPoint{Inputs: inputs, Outputs: outputs})
+		}
+	}
+	return dataset, classes, nil
+}
+
+func decodeImageFile(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %w", path, err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// Returns the pixels of the image resized to the size of the options, see ImageFolderOptions
+func imagePixels(img image.Image, options ImageFolderOptions) ([]float64, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	channels := 3
+	if options.Grayscale {
+		channels = 1
+	}
+	pixels := make([]float64, 0, options.Width*options.Height*channels)
+	for y := 0; y < options.Height; y++ {
+		srcY := bounds.Min.Y + y*height/options.Height
+		for x := 0; x < options.Width; x++ {
+			srcX := bounds.Min.X + x*width/options.Width
+			// 16 bits per channel, alpha-premultiplied
+			r, g, b, _ := img.At(srcX, srcY).RGBA()
+			if options.Grayscale {
+				// Same weights as color.GrayModel
+				pixels = append(pixels, (0.299*float64(r)+0.587*float64(g)+0.114*float64(b))/0xffff)
+			} else {
+				pixels = append(pixels, float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff)
+			}
+		}
+	}
+	return pixels, nil
+}
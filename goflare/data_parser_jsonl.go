@@ -0,0 +1,214 @@
+package goflare
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+type JSONLinesOptions struct {
+	// Keys read as columns, in order. By default, the keys of the first object.
+	// The keys missing from an object are missing values, and the keys not in the columns are an error.
+	Columns []string
+}
+
+// Reads JSON Lines (one JSON object per line) row by row, see RowIterator.
+// The values are float64, string, bool, nil for null, or []float64 for arrays of numbers.
+type JSONLinesReader struct {
+	r       *bufio.Reader
+	closer  io.Closer
+	columns []string
+	index   map[string]int
+	line    int
+	// Read ahead to get the columns
+	first    []any
+	hasFirst bool
+}
+
+// Reads JSON Lines from any reader. If the columns are not set in the options, the first object is read immediately.
+func NewJSONLinesReader(r io.Reader, options JSONLinesOptions) (*JSONLinesReader, error) {
+	jr := &JSONLinesReader{r: bufio.NewReader(r)}
+	if options.Columns != nil {
+		jr.setColumns(options.Columns)
+		return jr, nil
+	}
+
+	line, err := jr.readLine()
+	if err == io.EOF {
+		return jr, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read json lines: %w", err)
+	}
+	keys, values, err := decodeJSONObject(line)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read json lines: line %d: %w", jr.line, err)
+	}
+	jr.setColumns(keys)
+	jr.first, jr.hasFirst = values, true
+	return jr, nil
+}
+
+// Opens a JSON Lines file, which is closed by JSONLinesReader.Close
+func OpenJSONLines(path string, options JSONLinesOptions) (*JSONLinesReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %w", path, err)
+	}
+	jr, err := NewJSONLinesReader(f, options)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	jr.closer = f
+	return jr, nil
+}
+
+func (jr *JSONLinesReader) setColumns(columns []string) {
+	jr.columns = columns
+	jr.index = make(map[string]int, len(columns))
+	for i, c := range columns {
+		jr.index[c] = i
+	}
+}
+
+func (jr *JSONLinesReader) Columns() []string {
+	return jr.columns
+}
+
+// Returns the next non-empty line, without the line break
+func (jr *JSONLinesReader) readLine() ([]byte, error) {
+	for {
+		line, err := jr.r.ReadBytes('\n')
+		if err != nil && !(err == io.EOF && len(line) > 0) {
+			return nil, err
+		}
+		jr.line++
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			return line, nil
+		}
+	}
+}
+
+func (jr *JSONLinesReader) Next() ([]any, error) {
+	if jr.hasFirst {
+		jr.hasFirst = false
+		return jr.first, nil
+	}
+	line, err := jr.readLine()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read json lines: %w", err)
+	}
+	keys, values, err := decodeJSONObject(line)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read json lines: line %d: %w", jr.line, err)
+	}
+	row := make([]any, len(jr.columns))
+	for i, key := range keys {
+		col, ok := jr.index[key]
+		if !ok {
+			return nil, fmt.Errorf("cannot read json lines: line %d: unknown column %q", jr.line, key)
+		}
+		row[col] = values[i]
+	}
+	return row, nil
+}
+
+// Reads all the remaining rows into a DataStream, named after the columns
+func (jr *JSONLinesReader) ReadAll() (*DataStream, error) {
+	ds := NewDataStream(0)
+	for {
+		row, err := jr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ds.data = append(ds.data, row)
+	}
+	if err := ds.SetColumns(jr.columns); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// Closes the underlying file, if opened by OpenJSONLines
+func (jr *JSONLinesReader) Close() error {
+	if jr.closer == nil {
+		return nil
+	}
+	return jr.closer.Close()
+}
+
+// Decodes a flat JSON object, keeping the order of its keys
+func decodeJSONObject(data []byte) (keys []string, values []any, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, nil, errors.New("not a JSON object")
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := t.(string)
+		var value any
+		if err = dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		if value, err = jsonValue(value); err != nil {
+			return nil, nil, fmt.Errorf("key %q: %w", key, err)
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	if dec.More() {
+		return nil, nil, errors.New("trailing data after the JSON object")
+	}
+	return keys, values, nil
+}
+
+func jsonValue(value any) (any, error) {
+	switch v := value.(type) {
+	case nil, float64, string, bool:
+		return v, nil
+	case []any:
+		floats := make([]float64, len(v))
+		for i := range v {
+			f, ok := v[i].(float64)
+			if !ok {
+				return nil, errors.New("only arrays of numbers are supported")
+			}
+			floats[i] = f
+		}
+		return floats, nil
+	default:
+		return nil, fmt.Errorf("unsupported value of type %T", v)
+	}
+}
+
+// Reads a whole JSON Lines file into memory. See OpenJSONLines to read it row by row instead.
+func JSONLinesDataStream(path string) (*DataStream, error) {
+	jr, err := OpenJSONLines(path, JSONLinesOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer jr.Close()
+	ds, err := jr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ds, nil
+}
@@ -0,0 +1,92 @@
+package goflare
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type LibSVMOptions struct {
+	// Number of features, i.e. the size of the dense inputs. The indices beyond it are an error.
+	NbFeatures int
+	// Whether the feature indices start at 0 instead of 1
+	ZeroBased bool
+}
+
+// Reads a sparse LibSVM/SVMlight file ("<label> <index>:<value> ..." per line) into a dense Dataset.
+// The absent features are 0, the output is the label, and the comments (after '#') and query ids ("qid:") are ignored.
+func LibSVMDataset(r io.Reader, options LibSVMOptions) (Dataset, error) {
+	if options.NbFeatures <= 0 {
+		return nil, fmt.Errorf("cannot read libsvm: invalid number of features %d", options.NbFeatures)
+	}
+	firstIndex := 1
+	if options.ZeroBased {
+		firstIndex = 0
+	}
+
+	dataset := make(Dataset, 0)
+	br := bufio.NewReader(r)
+	for lineNb := 1; ; lineNb++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && !(err == io.EOF && len(line) > 0) {
+			if err == io.EOF {
+				return dataset, nil
+			}
+			return nil, fmt.Errorf("cannot read libsvm: %w", err)
+		}
+		if i := bytes.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			continue
+		}
+
+		label, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read libsvm: line %d: invalid label %q", lineNb, fields[0])
+		}
+		point := DataPoint{
+			Inputs:  make([]float64, options.NbFeatures),
+			Outputs: []float64{label},
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, ":")
+			if !ok {
+				return nil, fmt.Errorf("cannot read libsvm: line %d: invalid feature %q", lineNb, field)
+			}
+			if key == "qid" {
+				continue
+			}
+			index, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read libsvm: line %d: invalid feature index %q", lineNb, key)
+			}
+			if index < firstIndex || index-firstIndex >= options.NbFeatures {
+				return nil, fmt.Errorf("cannot read libsvm: line %d: feature index %d out of [%d, %d]", lineNb, index, firstIndex, firstIndex+options.NbFeatures-1)
+			}
+			if point.Inputs[index-firstIndex], err = strconv.ParseFloat(value, 64); err != nil {
+				return nil, fmt.Errorf("cannot read libsvm: line %d: invalid feature value %q", lineNb, value)
+			}
+		}
+		dataset = append(dataset, point)
+	}
+}
+
+// Same as LibSVMDataset, from a file
+func LibSVMFileDataset(path string, options LibSVMOptions) (Dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %w", path, err)
+	}
+	defer f.Close()
+	dataset, err := LibSVMDataset(f, options)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return dataset, nil
+}
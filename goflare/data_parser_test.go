@@ -0,0 +1,280 @@
+package goflare
+
+import (
+	"bytes"
+	"compress/gzip"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVReader(t *testing.T) {
+	assert := assert.New(t)
+	cr, err := NewCSVReader(strings.NewReader("name;comment\n'a;b';'say \"hi\"'\n# skipped\nc;'it''s'\n"), CSVOptions{Comma: ';', Quote: '\'', Comment: '#'})
+	assert.NoError(err)
+	assert.Equal([]string{"name", "comment"}, cr.Columns())
+	row, err := cr.Next()
+	assert.NoError(err)
+	assert.Equal([]any{"a;b", `say "hi"`}, row)
+	row, err = cr.Next()
+	assert.NoError(err)
+	assert.Equal([]any{"c", "it's"}, row)
+	_, err = cr.Next()
+	assert.Equal(io.EOF, err)
+
+	t.Run("No header", func(t *testing.T) {
+		cr, err := NewCSVReader(strings.NewReader("1,2\n3,4\n"), CSVOptions{NoHeader: true})
+		assert.NoError(err)
+		ds, err := cr.ReadAll()
+		assert.NoError(err)
+		assert.Nil(cr.Columns())
+		assert.Equal([][]any{{"1", "2"}, {"3", "4"}}, ds.data)
+	})
+
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "data.csv")
+		assert.NoError(os.WriteFile(path, []byte("x,y\n1,2\n"), 0o644))
+		ds, err := CSVDataStream(path)
+		assert.NoError(err)
+		assert.Equal([]string{"x", "y"}, ds.Schema().Names())
+		assert.Equal([][]any{{"1", "2"}}, ds.data)
+
+		cr, err := OpenCSV(path, CSVOptions{})
+		assert.NoError(err)
+		assert.NoError(cr.Close())
+		assert.ErrorIs(cr.closer.Close(), os.ErrClosed)
+	})
+}
+
+func TestDataPipelineIterator(t *testing.T) {
+	assert := assert.New(t)
+	const data = "x,label,y\n1,a,10\n,b,20\n3,a,\n5,b,40\n"
+	newPipeline := func() *DataPipeline {
+		dp := NewDataPipeline(3, []int{1}, DropMissingRows())
+		dp.AddInputProcessor(PPToFloats())
+		dp.AddInputProcessor(PPStandardScaler())
+		dp.AddTargetProcessor(PPLabelEncoder())
+		return dp
+	}
+
+	// Reference: everything in memory
+	cr, err := NewCSVReader(strings.NewReader(data), CSVOptions{})
+	assert.NoError(err)
+	ds, err := cr.ReadAll()
+	assert.NoError(err)
+	assert.NoError(ds.ApplyPipeline(newPipeline()))
+	expected, err := ds.ToDataset([]int{1})
+	assert.NoError(err)
+	assert.Len(expected, 2)
+
+	dp := newPipeline()
+	opened := 0
+	assert.NoError(dp.FitIterator(func() (RowIterator, error) {
+		opened++
+		return NewCSVReader(strings.NewReader(data), CSVOptions{})
+	}))
+	// One pass per processor stage of the inputs
+	assert.Equal(2, opened)
+	cr, err = NewCSVReader(strings.NewReader(data), CSVOptions{})
+	assert.NoError(err)
+	dataset, err := dp.ToDataset(cr)
+	assert.NoError(err)
+	assert.Equal(expected, dataset)
+
+	t.Run("DataLoader", func(t *testing.T) {
+		open := func() (RowIterator, error) {
+			opened++
+			return NewCSVReader(strings.NewReader(data), CSVOptions{})
+		}
+		opened = 0
+		loader, err := NewStreamDataLoader(open, dp, 1)
+		assert.NoError(err)
+		batches := loader.Batches()
+		assert.NoError(loader.Err())
+		assert.Equal([]Dataset{expected[:1], expected[1:]}, batches)
+
+		// The rows are read again at each epoch
+		network := NewNetwork([]Layer{NewDenseLayer(2, 1, Linear)})
+		history, err := (&NetworkTrainer{NbWorkers: 1}).Fit(&network, loader, NewSGD(&network, MSELoss, 0.1, 0), FitOptions{Epochs: 2})
+		assert.NoError(err)
+		assert.Len(history.Epochs, 2)
+		assert.Equal(3, opened)
+
+		loader, err = NewStreamDataLoader(open, dp, 2, DropLast())
+		assert.NoError(err)
+		assert.Equal([]Dataset{expected}, loader.Batches())
+
+		_, err = NewStreamDataLoader(open, dp, 1, WithSampler(RandomSampler{}))
+		assert.EqualError(err, "cannot sample the data points of a stream")
+
+		loader, err = NewStreamDataLoader(func() (RowIterator, error) {
+			return NewCSVReader(strings.NewReader("x,label,y\n1,a,10\n1,a,x\n"), CSVOptions{})
+		}, dp, 1)
+		assert.NoError(err)
+		assert.Len(loader.Batches(), 1)
+		assert.ErrorContains(loader.Err(), "cannot process row 1 col 2")
+	})
+
+	t.Run("Processing error", func(t *testing.T) {
+		cr, err := NewCSVReader(strings.NewReader("x,label,y\n1,a,x\n"), CSVOptions{})
+		assert.NoError(err)
+		_, err = dp.ToDataset(cr)
+		assert.ErrorContains(err, "cannot process row 0 col 2")
+	})
+}
+
+func TestJSONLinesReader(t *testing.T) {
+	assert := assert.New(t)
+	const data = `{"size": 1.5, "color": "red", "pixels": [0, 1], "ok": true}
+
+{"color": "blue", "size": null, "pixels": [1, 0]}
+`
+	jr, err := NewJSONLinesReader(strings.NewReader(data), JSONLinesOptions{})
+	assert.NoError(err)
+	assert.Equal([]string{"size", "color", "pixels", "ok"}, jr.Columns())
+	ds, err := jr.ReadAll()
+	assert.NoError(err)
+	assert.Equal([][]any{
+		{1.5, "red", []float64{0, 1}, true},
+		{nil, "blue", []float64{1, 0}, nil},
+	}, ds.data)
+	assert.Equal(Schema{{"size", ColumnNumeric}, {"color", ColumnCategorical}, {"pixels", ColumnNumeric}, {"ok", ColumnCategorical}}, ds.Schema())
+
+	tests := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{"Unknown column", "{\"a\": 1}\n{\"b\": 2}", `cannot read json lines: line 2: unknown column "b"`},
+		{"Not an object", "{\"a\": 1}\n[1]", "cannot read json lines: line 2: not a JSON object"},
+		{"Nested object", "{\"a\": 1}\n\n{\"a\": {\"b\": 2}}", `cannot read json lines: line 3: key "a": unsupported value of type map[string]interface {}`},
+		{"Mixed array", "{\"a\": [1, \"x\"]}", `cannot read json lines: line 1: key "a": only arrays of numbers are supported`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jr, err := NewJSONLinesReader(strings.NewReader(tt.data), JSONLinesOptions{})
+			if err == nil {
+				_, err = jr.ReadAll()
+			}
+			assert.EqualError(err, tt.expected)
+		})
+	}
+}
+
+func TestLibSVMDataset(t *testing.T) {
+	assert := assert.New(t)
+	const data = "1 1:0.5 3:2 # comment\n\n-1 qid:3 2:1.5\n0\n"
+	dataset, err := LibSVMDataset(strings.NewReader(data), LibSVMOptions{NbFeatures: 3})
+	assert.NoError(err)
+	assert.Equal(Dataset{
+		{Inputs: []float64{0.5, 0, 2}, Outputs: []float64{1}},
+		{Inputs: []float64{0, 1.5, 0}, Outputs: []float64{-1}},
+		{Inputs: []float64{0, 0, 0}, Outputs: []float64{0}},
+	}, dataset)
+
+	dataset, err = LibSVMDataset(strings.NewReader("1 0:1 2:3"), LibSVMOptions{NbFeatures: 3, ZeroBased: true})
+	assert.NoError(err)
+	assert.Equal(Dataset{{Inputs: []float64{1, 0, 3}, Outputs: []float64{1}}}, dataset)
+
+	_, err = LibSVMDataset(strings.NewReader("1 1:1\n1 4:1\n"), LibSVMOptions{NbFeatures: 3})
+	assert.EqualError(err, "cannot read libsvm: line 2: feature index 4 out of [1, 3]")
+	_, err = LibSVMDataset(strings.NewReader("1 1=1\n"), LibSVMOptions{NbFeatures: 3})
+	assert.EqualError(err, `cannot read libsvm: line 1: invalid feature "1=1"`)
+	_, err = LibSVMDataset(strings.NewReader("a 1:1\n"), LibSVMOptions{NbFeatures: 3})
+	assert.EqualError(err, `cannot read libsvm: line 1: invalid label "a"`)
+}
+
+func TestIDXDataset(t *testing.T) {
+	assert := assert.New(t)
+	// 2 images of 2x2 unsigned bytes, and their labels
+	images := []byte{0, 0, 0x08, 3, 0, 0, 0, 2, 0, 0, 0, 2, 0, 0, 0, 2, 0, 255, 51, 102, 255, 0, 0, 0}
+	labels := []byte{0, 0, 0x08, 1, 0, 0, 0, 2, 2, 0}
+	dataset, err := IDXDataset(bytes.NewReader(images), bytes.NewReader(labels), 3)
+	assert.NoError(err)
+	assert.Equal(Dataset{
+		{Inputs: []float64{0, 1, 0.2, 0.4}, Outputs: []float64{0, 0, 1}},
+		{Inputs: []float64{1, 0, 0, 0}, Outputs: []float64{1, 0, 0}},
+	}, dataset)
+
+	_, err = IDXDataset(bytes.NewReader(images), bytes.NewReader(labels), 2)
+	assert.EqualError(err, "label 2 of image 0 is not in [0, 2)")
+	_, err = IDXDataset(bytes.NewReader(images[:20]), bytes.NewReader(labels), 3)
+	assert.EqualError(err, "cannot read images: cannot read idx value 4/8: EOF")
+	_, err = IDXDataset(bytes.NewReader(images), bytes.NewReader([]byte{0, 0, 0x08, 1, 0, 0, 0, 1, 0}), 3)
+	assert.EqualError(err, "images of dimensions [2 2 2] do not match labels of dimensions [1]")
+
+	t.Run("Other types", func(t *testing.T) {
+		a, err := ReadIDX(bytes.NewReader([]byte{0, 0, 0x0B, 1, 0, 0, 0, 2, 0xff, 0xfe, 0x01, 0x00}))
+		assert.NoError(err)
+		assert.Equal(&IDXArray{Type: 0x0B, Dims: []int{2}, Data: []float64{-2, 256}}, a)
+		_, err = ReadIDX(bytes.NewReader([]byte{0, 0, 0x42, 1}))
+		assert.EqualError(err, "cannot read idx: invalid magic number 00004201")
+	})
+
+	t.Run("Corrupted header", func(t *testing.T) {
+		_, err := ReadIDX(bytes.NewReader([]byte{0, 0, 0x08, 3, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}))
+		assert.EqualError(err, "cannot read idx: dimension 1 of size 4294967295 is too large")
+		_, err = ReadIDX(bytes.NewReader([]byte{0, 0, 0x08, 2, 0, 0, 0, 2, 0, 0, 0, 0}))
+		assert.EqualError(err, "cannot read idx: dimension 1 is 0")
+		// Large but valid dimensions only fail on the missing values
+		_, err = ReadIDX(bytes.NewReader([]byte{0, 0, 0x0E, 2, 0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0}))
+		assert.EqualError(err, "cannot read idx value 0/4294967296: unexpected EOF")
+	})
+
+	t.Run("Gzipped files", func(t *testing.T) {
+		dir := t.TempDir()
+		var gz bytes.Buffer
+		w := gzip.NewWriter(&gz)
+		w.Write(images)
+		w.Close()
+		assert.NoError(os.WriteFile(filepath.Join(dir, "images.gz"), gz.Bytes(), 0o644))
+		assert.NoError(os.WriteFile(filepath.Join(dir, "labels"), labels, 0o644))
+		dataset, err := IDXFileDataset(filepath.Join(dir, "images.gz"), filepath.Join(dir, "labels"), 3)
+		assert.NoError(err)
+		assert.Len(dataset, 2)
+		assert.Equal([]float64{1, 0, 0, 0}, dataset[1].Inputs)
+	})
+}
+
+func TestImageFolderDataset(t *testing.T) {
+	assert := assert.New(t)
+	root := t.TempDir()
+	writeImage := func(path string, width int, c color.Color) {
+		img := image.NewRGBA(image.Rect(0, 0, width, 2))
+		for x := 0; x < width; x++ {
+			img.Set(x, 0, c)
+			img.Set(x, 1, color.White)
+		}
+		assert.NoError(os.MkdirAll(filepath.Dir(path), 0o755))
+		f, err := os.Create(path)
+		assert.NoError(err)
+		assert.NoError(png.Encode(f, img))
+		f.Close()
+	}
+	writeImage(filepath.Join(root, "red", "1.png"), 2, color.RGBA{255, 0, 0, 255})
+	writeImage(filepath.Join(root, "black", "1.png"), 2, color.Black)
+	assert.NoError(os.WriteFile(filepath.Join(root, "black", "README"), nil, 0o644))
+
+	dataset, classes, err := ImageFolderDataset(root, ImageFolderOptions{})
+	assert.NoError(err)
+	assert.Equal([]string{"black", "red"}, classes)
+	assert.Equal(Dataset{
+		{Inputs: []float64{0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1}, Outputs: []float64{1, 0}},
+		{Inputs: []float64{1, 0, 0, 1, 0, 0, 1, 1, 1, 1, 1, 1}, Outputs: []float64{0, 1}},
+	}, dataset)
+
+	dataset, _, err = ImageFolderDataset(root, ImageFolderOptions{Width: 1, Height: 2, Grayscale: true})
+	assert.NoError(err)
+	assert.InDeltaSlice([]float64{0.299, 1}, dataset[1].Inputs, 1e-9)
+
+	writeImage(filepath.Join(root, "red", "2.png"), 4, color.Black)
+	_, _, err = ImageFolderDataset(root, ImageFolderOptions{})
+	assert.ErrorContains(err, "size 4x2 differs from the previous images 2x2")
+}
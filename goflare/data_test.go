@@ -51,3 +51,47 @@ func TestRandomSplitWithSource(t *testing.T) {
 		assert.Equal([]int{2435, 4998, 1295, 1272}, lenghts)
 	})
 }
+
+func TestDataStreamSchema(t *testing.T) {
+	assert := assert.New(t)
+	ds := NewDataStream(3)
+	ds.data = append(ds.data,
+		[]any{"id1", "1.5", "", "dog"},
+		[]any{"id2", "2", "", "cat"},
+		[]any{"id3", "x", "", "cat"},
+	)
+	assert.EqualError(ds.SetColumns([]string{"id", "size"}), "2 column names for 4 columns")
+	assert.EqualError(ds.SetColumns([]string{"id", "size", "id", "label"}), `duplicate column "id"`)
+	assert.NoError(ds.SetColumns([]string{"id", "size", "empty", "label"}))
+	assert.Equal(Schema{
+		{"id", ColumnCategorical},
+		{"size", ColumnCategorical},
+		{"empty", ColumnUnknown},
+		{"label", ColumnCategorical},
+	}, ds.Schema())
+
+	ds.data[2][1] = "3"
+	schema := ds.Schema()
+	assert.Equal(ColumnNumeric, schema[1].Type)
+
+	_, err := NewDataPipelineFromSchema(schema, []string{"class"})
+	assert.EqualError(err, `unknown column "class"`)
+	_, err = NewDataPipelineFromSchema(schema, []string{"label"}, IgnoreNamedColumns("ID"))
+	assert.EqualError(err, `unknown column "ID"`)
+
+	dp, err := NewDataPipelineFromSchema(schema, []string{"label"}, IgnoreNamedColumns("id", "empty"))
+	assert.NoError(err)
+	assert.EqualError(dp.AddNamedColumnProcessor([]string{"Size"}, PPToFloats()), `unknown column "Size"`)
+	assert.NoError(dp.AddNamedColumnProcessor([]string{"size"}, PPToFloats()))
+	dp.AddTargetProcessor(PPLabelEncoder())
+	assert.NoError(ds.ApplyPipeline(dp))
+	dataset, err := ds.ToDatasetByName("label")
+	assert.NoError(err)
+	assert.Equal(Dataset{
+		{Inputs: []float64{1.5}, Outputs: []float64{1}},
+		{Inputs: []float64{2}, Outputs: []float64{0}},
+		{Inputs: []float64{3}, Outputs: []float64{0}},
+	}, dataset)
+	_, err = ds.ToDatasetByName("class")
+	assert.EqualError(err, `unknown column "class"`)
+}
@@ -0,0 +1,248 @@
+package goflare
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+
+	"github.com/jjunac/goflare/utils"
+
+	"gonum.org/v1/gonum/blas"
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Fully connected layer: outputs = activation(inputs x weights + biases)
+type DenseLayer struct {
+	NodesIn  int
+	NodesOut int
+	// Contiguous NodesIn x NodesOut matrix, stored row by row: the weight from input i to output j is at i*NodesOut+j.
+	// See Weight, WeightRow and WeightsMatrix.
+	Weights    []float64
+	Biases     []float64
+	Activation ActivationFunc
+
+	initializer Initializer
+	rng         *rand.Rand
+}
+
+type DenseLayerOption func(l *DenseLayer)
+
+// Sets how the weights are initialized, uniformly in [-1, 1] by default
+func WithInitializer(initializer Initializer) DenseLayerOption {
+	return func(l *DenseLayer) {
+		l.initializer = initializer
+	}
+}
+
+// Sets the random source used to initialize the weights, for reproducible runs.
+// By default, a source seeded from the global math/rand one is used.
+// NOTE: rand.Rand is *NOT* thread safe, the layers sharing it must not be reset in parallel
+func WithRand(rng *rand.Rand) DenseLayerOption {
+	return func(l *DenseLayer) {
+		l.rng = rng
+	}
+}
+
+func init() {
+	RegisterLayerType("Dense", func() Layer { return &DenseLayer{} })
+}
+
+func NewDenseLayer(nodesIn int, nodesOut int, activation ActivationFunc, options ...DenseLayerOption) *DenseLayer {
+	l := &DenseLayer{
+		NodesIn:    nodesIn,
+		NodesOut:   nodesOut,
+		Weights:    make([]float64, nodesIn*nodesOut),
+		Biases:     make([]float64, nodesOut),
+		Activation: activation,
+	}
+	for i := range options {
+		options[i](l)
+	}
+	l.Reset()
+	return l
+}
+
+func (l *DenseLayer) InputSize() int {
+	return l.NodesIn
+}
+
+func (l *DenseLayer) OutputSize() int {
+	return l.NodesOut
+}
+
+func (l *DenseLayer) Copy() Layer {
+	return &DenseLayer{
+		NodesIn:    l.NodesIn,
+		NodesOut:   l.NodesOut,
+		Weights:    utils.CopySlice(l.Weights),
+		Biases:     utils.CopySlice(l.Biases),
+		Activation: l.Activation,
+
+		initializer: l.initializer,
+		rng:         l.rng,
+	}
+}
+
+// Checks that the parameters have the declared shape, since they can come from a file
+func (l *DenseLayer) UnmarshalJSON(data []byte) error {
+	type denseLayer DenseLayer // Without the methods, to avoid recursing
+	if err := json.Unmarshal(data, (*denseLayer)(l)); err != nil {
+		return err
+	}
+	if len(l.Weights) != l.NodesIn*l.NodesOut || len(l.Biases) != l.NodesOut {
+		return fmt.Errorf("dense layer %dx%d has %d weights and %d biases", l.NodesIn, l.NodesOut, len(l.Weights), len(l.Biases))
+	}
+	return nil
+}
+
+// The weights, followed by the biases
+func (l *DenseLayer) Parameters() [][]float64 {
+	return [][]float64{l.Weights, l.Biases}
+}
+
+func (l *DenseLayer) Weight(in int, out int) float64 {
+	return l.Weights[in*l.NodesOut+out]
+}
+
+func (l *DenseLayer) SetWeight(in int, out int, weight float64) {
+	l.Weights[in*l.NodesOut+out] = weight
+}
+
+// Returns the weights from an input to each output. The slice is shared with the layer.
+func (l *DenseLayer) WeightRow(in int) []float64 {
+	return l.Weights[in*l.NodesOut : (in+1)*l.NodesOut]
+}
+
+// Returns a matrix view of the weights, one row per input. The values are shared with the layer, not copied.
+func (l *DenseLayer) WeightsMatrix() *mat.Dense {
+	return mat.NewDense(l.NodesIn, l.NodesOut, l.Weights)
+}
+
+func (l *DenseLayer) OutputActivation() *ActivationFunc {
+	return &l.Activation
+}
+
+func (l *DenseLayer) weightedValues(inputs []float64) []float64 {
+	values := utils.CopySlice(l.Biases)
+	for in := 0; in < l.NodesIn; in++ {
+		input := inputs[in]
+		for out, weight := range l.WeightRow(in) {
+			values[out] += input * weight
+		}
+	}
+	return values
+}
+
+func (l *DenseLayer) Evaluate(inputs []float64) (outputs []float64) {
+	return l.Activation.Vectorized(l.weightedValues(inputs))
+}
+
+func (l *DenseLayer) EvaluateWithLearnData(inputs []float64, learnData *LayerLearnData) (outputs []float64) {
+	learnData.Inputs = inputs
+	learnData.WeightedValues = l.weightedValues(inputs)
+	outputs = l.Activation.Vectorized(learnData.WeightedValues)
+	learnData.Outputs = outputs
+	return
+}
+
+func (l *DenseLayer) Backward(outputsGradient []float64, learnData *LayerLearnData, gradients [][]float64) (inputsGradient []float64) {
+	return l.BackwardWeighted(l.Activation.Backward(learnData.WeightedValues, learnData.Outputs, outputsGradient), learnData, gradients)
+}
+
+func (l *DenseLayer) BackwardWeighted(weightedGradient []float64, learnData *LayerLearnData, gradients [][]float64) (inputsGradient []float64) {
+	learnData.LossDerivative = weightedGradient
+
+	inputsGradient = make([]float64, l.NodesIn)
+	gradientB := gradients[1]
+	for out, lossDerivative := range learnData.LossDerivative {
+		gradientB[out] += lossDerivative
+	}
+	for in := 0; in < l.NodesIn; in++ {
+		weights := l.WeightRow(in)
+		gradientW := gradients[0][in*l.NodesOut : (in+1)*l.NodesOut]
+		input := learnData.Inputs[in]
+		inputGradient := float64(0)
+		for out, lossDerivative := range learnData.LossDerivative {
+			gradientW[out] += lossDerivative * input
+			inputGradient += lossDerivative * weights[out]
+		}
+		inputsGradient[in] = inputGradient
+	}
+	return
+}
+
+func (l *DenseLayer) weightedValuesBatch(inputs *mat.Dense) *mat.Dense {
+	var values mat.Dense
+	values.Mul(inputs, l.WeightsMatrix())
+	rows, _ := values.Dims()
+	for i := 0; i < rows; i++ {
+		row := values.RawRowView(i)
+		for out := range row {
+			row[out] += l.Biases[out]
+		}
+	}
+	return &values
+}
+
+func (l *DenseLayer) activateBatch(values *mat.Dense) *mat.Dense {
+	rows, cols := values.Dims()
+	outputs := mat.NewDense(rows, cols, nil)
+	for i := 0; i < rows; i++ {
+		copy(outputs.RawRowView(i), l.Activation.Vectorized(values.RawRowView(i)))
+	}
+	return outputs
+}
+
+func (l *DenseLayer) EvaluateBatch(inputs *mat.Dense) (outputs *mat.Dense) {
+	return l.activateBatch(l.weightedValuesBatch(inputs))
+}
+
+func (l *DenseLayer) EvaluateBatchWithLearnData(inputs *mat.Dense, learnData *BatchLayerLearnData) (outputs *mat.Dense) {
+	learnData.Inputs = inputs
+	learnData.WeightedValues = l.weightedValuesBatch(inputs)
+	outputs = l.activateBatch(learnData.WeightedValues)
+	learnData.Outputs = outputs
+	return
+}
+
+func (l *DenseLayer) BackwardBatch(outputsGradient *mat.Dense, learnData *BatchLayerLearnData, gradients [][]float64) (inputsGradient *mat.Dense) {
+	rows, cols := outputsGradient.Dims()
+	weightedGradient := mat.NewDense(rows, cols, nil)
+	for i := 0; i < rows; i++ {
+		copy(weightedGradient.RawRowView(i), l.Activation.Backward(learnData.WeightedValues.RawRowView(i), learnData.Outputs.RawRowView(i), outputsGradient.RawRowView(i)))
+	}
+	return l.BackwardWeightedBatch(weightedGradient, learnData, gradients)
+}
+
+func (l *DenseLayer) BackwardWeightedBatch(weightedGradient *mat.Dense, learnData *BatchLayerLearnData, gradients [][]float64) (inputsGradient *mat.Dense) {
+	learnData.LossDerivative = weightedGradient
+
+	// Accumulating directly into the gradients: gradientW += inputs^T x weightedGradient
+	gradientW := mat.NewDense(l.NodesIn, l.NodesOut, gradients[0])
+	blas64.Gemm(blas.Trans, blas.NoTrans, 1, learnData.Inputs.RawMatrix(), weightedGradient.RawMatrix(), 1, gradientW.RawMatrix())
+	rows, _ := weightedGradient.Dims()
+	gradientB := gradients[1]
+	for i := 0; i < rows; i++ {
+		for out, lossDerivative := range weightedGradient.RawRowView(i) {
+			gradientB[out] += lossDerivative
+		}
+	}
+
+	inputsGradient = &mat.Dense{}
+	inputsGradient.Mul(weightedGradient, l.WeightsMatrix().T())
+	return
+}
+
+func (l *DenseLayer) Reset() {
+	if l.initializer == nil {
+		l.initializer = UniformInit(-1, 1)
+	}
+	if l.rng == nil {
+		l.rng = rand.New(rand.NewSource(rand.Int63()))
+	}
+	copy(l.Weights, l.initializer(l.rng, l.NodesIn, l.NodesOut))
+	for out := range l.Biases {
+		l.Biases[out] = 0
+	}
+}
@@ -0,0 +1,123 @@
+package goflare
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jjunac/goflare/utils"
+)
+
+// Learns the categories of a column while fitting, and encodes them either as their index or as one-hot vectors
+type categoryEncoder struct {
+	oneHot bool
+	// Whether an unknown category is an error, or encoded as a vector of zeros
+	strict     bool
+	categories []any
+	index      map[any]int
+	sorted     bool
+}
+
+func newCategoryEncoder(oneHot bool, strict bool) *categoryEncoder {
+	return &categoryEncoder{
+		oneHot: oneHot,
+		strict: strict,
+		index:  make(map[any]int),
+	}
+}
+
+func (ce *categoryEncoder) Fit(value any) error {
+	switch value.(type) {
+	case string, float64, int, bool:
+	default:
+		return fmt.Errorf("unsupported category type %T", value)
+	}
+	if _, ok := ce.index[value]; !ok {
+		ce.index[value] = len(ce.categories)
+		ce.categories = append(ce.categories, value)
+		ce.sorted = false
+	}
+	return nil
+}
+
+// Sorts the categories once all of them are known, so that their order doesn't depend on the order of the rows
+func (ce *categoryEncoder) sortCategories() {
+	if ce.sorted {
+		return
+	}
+	sort.SliceStable(ce.categories, func(i, j int) bool {
+		a, b := ce.categories[i], ce.categories[j]
+		if fa, ok := a.(float64); ok {
+			if fb, ok := b.(float64); ok {
+				return fa < fb
+			}
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	})
+	for i, c := range ce.categories {
+		ce.index[c] = i
+	}
+	ce.sorted = true
+}
+
+func (ce *categoryEncoder) Transform(value any) (any, error) {
+	ce.sortCategories()
+	i, ok := ce.index[value]
+	if !ok && ce.strict {
+		return nil, fmt.Errorf("unknown category %v", value)
+	}
+	if !ce.oneHot {
+		return float64(i), nil
+	}
+	encoded := make([]float64, len(ce.categories))
+	if ok {
+		encoded[i] = 1
+	}
+	return encoded, nil
+}
+
+func (ce *categoryEncoder) names() []string {
+	ce.sortCategories()
+	return utils.InitSlice(len(ce.categories), func(i int) string { return fmt.Sprint(ce.categories[i]) })
+}
+
+// Expands a categorical column into one column per category, holding 1 for the category of the row and 0 for the
+// others. Unlike PPStringValueMapper, this doesn't impose an order between the categories.
+// The categories are learnt while fitting; unknown ones (e.g. in test data) are encoded with 0 in all the columns.
+func PPOneHotEncoder() PipelineProcessor {
+	return func() ColumnProcessor {
+		return newCategoryEncoder(true, false)
+	}
+}
+
+// Replaces each category by its index in the sorted categories learnt while fitting.
+// Unknown categories are an error.
+func PPLabelEncoder() PipelineProcessor {
+	return func() ColumnProcessor {
+		return newCategoryEncoder(false, true)
+	}
+}
+
+// Encodes a class label column into one-hot output vectors, and keeps the class names, e.g. for NewConfusionMatrix.
+// NOTE: The processor must be added on a single column
+type TargetEncoder struct {
+	encoder *categoryEncoder
+}
+
+func NewTargetEncoder() *TargetEncoder {
+	return &TargetEncoder{}
+}
+
+func (te *TargetEncoder) Processor() PipelineProcessor {
+	return func() ColumnProcessor {
+		te.encoder = newCategoryEncoder(true, true)
+		return te.encoder
+	}
+}
+
+// Returns the class names, in the order of the outputs. Only available once the pipeline is fitted.
+func (te *TargetEncoder) Classes() []string {
+	if te.encoder == nil {
+		return nil
+	}
+	return te.encoder.names()
+}
@@ -0,0 +1,80 @@
+package goflare
+
+import "math"
+
+// Limits the gradients accumulated for a step before the update, so that an exploding gradient doesn't make the
+// training diverge. The clippings are applied in the order of the fields, 0 disabling them.
+// The thresholds apply to the mean gradient of the data points of the batch, so they don't depend on its size.
+type GradientClipping struct {
+	// Clamps each gradient into [-Value, Value]
+	Value float64
+	// Scales down the gradients of each layer whose L2 norm, over all its parameters, exceeds LayerNorm
+	LayerNorm float64
+	// Scales down all the gradients when their L2 norm, across all the layers, exceeds GlobalNorm
+	GlobalNorm float64
+}
+
+func (o *optimizerBase) SetGradientClipping(c GradientClipping) {
+	o.clipping = c
+}
+
+func (o *optimizerBase) GradientNorm() float64 {
+	return o.gradientNorm
+}
+
+// Records the global norm of the mean gradient, then clips the gradients. The regularization gradients are added after.
+func (o *optimizerBase) clipGradients() {
+	// The gradients are summed over the data points: the thresholds of the mean gradient are scaled accordingly
+	n := float64(o.d.nbDataPoints)
+	if n == 0 {
+		n = 1
+	}
+	o.gradientNorm = math.Sqrt(o.d.squaredNorm()) / n
+	c := &o.clipping
+	if c.Value > 0 {
+		for _, ld := range o.d.layerD {
+			for _, gradient := range ld.Gradients {
+				for i := range gradient {
+					gradient[i] = math.Max(-c.Value*n, math.Min(c.Value*n, gradient[i]))
+				}
+			}
+		}
+	}
+	if c.LayerNorm > 0 {
+		for _, ld := range o.d.layerD {
+			if norm := math.Sqrt(ld.squaredNorm()); norm > c.LayerNorm*n {
+				ld.scale(c.LayerNorm * n / norm)
+			}
+		}
+	}
+	if c.GlobalNorm > 0 {
+		// The previous clippings may have reduced it
+		if norm := math.Sqrt(o.d.squaredNorm()); norm > c.GlobalNorm*n {
+			for _, ld := range o.d.layerD {
+				ld.scale(c.GlobalNorm * n / norm)
+			}
+		}
+	}
+}
+
+func (d *OptimizerData) squaredNorm() (sum float64) {
+	for _, ld := range d.layerD {
+		sum += ld.squaredNorm()
+	}
+	return
+}
+
+func (ld *OptimizerLayerData) squaredNorm() (sum float64) {
+	for _, gradient := range ld.Gradients {
+		for _, g := range gradient {
+			sum += g * g
+		}
+	}
+	return
+}
+
+func (ld *OptimizerLayerData) scale(factor float64) {
+	for _, gradient := range ld.Gradients {
+		scale(gradient, factor)
+	}
+}
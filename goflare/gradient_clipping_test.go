@@ -0,0 +1,50 @@
+package goflare
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jjunac/goflare/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGradientClipping(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		clipping GradientClipping
+		expected [][][]float64
+	}{
+		{GradientClipping{}, [][][]float64{{{3, -4, 0, 0}, {0, 0}}, {{12, 0}, {0}}}},
+		{GradientClipping{Value: 2}, [][][]float64{{{2, -2, 0, 0}, {0, 0}}, {{2, 0}, {0}}}},
+		{GradientClipping{LayerNorm: 6}, [][][]float64{{{3, -4, 0, 0}, {0, 0}}, {{6, 0}, {0}}}},
+		{GradientClipping{GlobalNorm: 6.5}, [][][]float64{{{1.5, -2, 0, 0}, {0, 0}}, {{6, 0}, {0}}}},
+		// The global norm is computed after the other clippings: sqrt(2² + 2² + 2²) < 6.5
+		{GradientClipping{Value: 2, GlobalNorm: 6.5}, [][][]float64{{{2, -2, 0, 0}, {0, 0}}, {{2, 0}, {0}}}},
+	}
+	// The thresholds apply to the mean gradient, whatever the number of data points (0 when set by hand like here)
+	for _, nbDataPoints := range []int{0, 3} {
+		factor := math.Max(1, float64(nbDataPoints))
+		for _, tt := range tests {
+			n := NewNetwork([]Layer{NewDenseLayer(2, 2, Linear), NewDenseLayer(2, 1, Linear)})
+			initial := CopyNetwork(&n)
+			o := NewSGD(&n, MSELoss, 1, 0)
+			o.SetGradientClipping(tt.clipping)
+			// Norm 5 for the first layer, 12 for the second one, 13 overall
+			o.d.layerD[0].Gradients = [][]float64{{3 * factor, -4 * factor, 0, 0}, {0, 0}}
+			o.d.layerD[1].Gradients = [][]float64{{12 * factor, 0}, {0}}
+			o.d.nbDataPoints = nbDataPoints
+			o.Step()
+
+			assert.Equal(13.0, o.GradientNorm())
+			for iLayer := range n.Layers {
+				for iParam, param := range n.Layers[iLayer].Parameters() {
+					expected := utils.CopySlice(initial.Layers[iLayer].Parameters()[iParam])
+					for i := range expected {
+						expected[i] -= factor * tt.expected[iLayer][iParam][i]
+					}
+					assert.InDeltaSlice(expected, param, 1e-9, "%+v, %d data points, layer %d, param %d", tt.clipping, nbDataPoints, iLayer, iParam)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package goflare
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// How an imputer replaces the missing values of a column
+type ImputeStrategy int
+
+const (
+	// Mean of the values, which must be float64
+	ImputeMean ImputeStrategy = iota
+	// Median of the values, which must be float64.
+	// NOTE: All the values are kept while fitting, unlike the other strategies using a constant memory
+	ImputeMedian
+	// Most frequent value, which must be a string, float64, int or bool. Ties are broken by comparing the printed values.
+	ImputeMostFrequent
+	// Fixed value, see WithFillValue
+	ImputeConstant
+)
+
+type ImputerOption func(imp *imputer)
+
+// Sets the value used by ImputeConstant, 0 by default
+func WithFillValue(value any) ImputerOption {
+	return func(imp *imputer) {
+		imp.fillValue = value
+	}
+}
+
+// Expands the column into [value, indicator], the indicator being 1 if the value was missing and 0 otherwise.
+// The values must be float64, and the imputer the last processor of the column.
+func WithMissingIndicator() ImputerOption {
+	return func(imp *imputer) {
+		imp.indicator = true
+	}
+}
+
+// Replaces the missing values of the column (see NullTokens) by a value computed from the others while fitting.
+// The missing values are skipped by the processors added before the imputer, e.g. PPToFloats.
+func PPImputer(strategy ImputeStrategy, options ...ImputerOption) PipelineProcessor {
+	return func() ColumnProcessor {
+		imp := &imputer{
+			strategy:  strategy,
+			fillValue: float64(0),
+			counts:    make(map[any]int),
+		}
+		for i := range options {
+			options[i](imp)
+		}
+		return imp
+	}
+}
+
+type imputer struct {
+	strategy  ImputeStrategy
+	fillValue any
+	indicator bool
+
+	// For ImputeMean
+	sum   float64
+	count int
+	// For ImputeMedian
+	values []float64
+	// For ImputeMostFrequent
+	counts map[any]int
+	// Computed on the first Transform
+	fitted bool
+	fill   any
+}
+
+func (imp *imputer) HandlesMissing() bool {
+	return true
+}
+
+func (imp *imputer) Fit(value any) error {
+	if value == nil {
+		return nil
+	}
+	switch imp.strategy {
+	case ImputeMean, ImputeMedian:
+		v, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("not a float64")
+		}
+		if imp.strategy == ImputeMean {
+			imp.sum += v
+			imp.count++
+		} else {
+			imp.values = append(imp.values, v)
+		}
+	case ImputeMostFrequent:
+		// Same types as the categories, the others (e.g. []float64) not being usable as map keys
+		switch value.(type) {
+		case string, float64, int, bool:
+		default:
+			return fmt.Errorf("unsupported value type %T", value)
+		}
+		imp.counts[value]++
+	}
+	imp.fitted = false
+	return nil
+}
+
+func (imp *imputer) computeFill() error {
+	if imp.fitted {
+		return nil
+	}
+	switch imp.strategy {
+	case ImputeMean:
+		if imp.count == 0 {
+			return errors.New("cannot impute a column without any value")
+		}
+		imp.fill = imp.sum / float64(imp.count)
+	case ImputeMedian:
+		if len(imp.values) == 0 {
+			return errors.New("cannot impute a column without any value")
+		}
+		sort.Float64s(imp.values)
+		mid := len(imp.values) / 2
+		if len(imp.values)%2 == 0 {
+			imp.fill = (imp.values[mid-1] + imp.values[mid]) / 2
+		} else {
+			imp.fill = imp.values[mid]
+		}
+	case ImputeMostFrequent:
+		if len(imp.counts) == 0 {
+			return errors.New("cannot impute a column without any value")
+		}
+		var best any
+		for v, count := range imp.counts {
+			// Comparing the printed values on ties, so that the result doesn't depend on the map order
+			if best == nil || count > imp.counts[best] || (count == imp.counts[best] && fmt.Sprint(v) < fmt.Sprint(best)) {
+				best = v
+			}
+		}
+		imp.fill = best
+	case ImputeConstant:
+		imp.fill = imp.fillValue
+	default:
+		return fmt.Errorf("unknown impute strategy %d", imp.strategy)
+	}
+	imp.fitted = true
+	return nil
+}
+
+func (imp *imputer) Transform(value any) (any, error) {
+	if err := imp.computeFill(); err != nil {
+		return nil, err
+	}
+	missing := value == nil
+	if missing {
+		value = imp.fill
+	}
+	if !imp.indicator {
+		return value, nil
+	}
+	v, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("missing indicator requires float64 values, got %T", value)
+	}
+	if missing {
+		return []float64{v, 1}, nil
+	}
+	return []float64{v, 0}, nil
+}
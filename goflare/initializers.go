@@ -0,0 +1,105 @@
+package goflare
+
+import (
+	"math"
+	"math/rand"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// An Initializer returns the initial weights of a layer with fanIn inputs and fanOut outputs, as a flat slice of fanIn
+// rows of fanOut values. It must only draw random numbers from rng, so that the initialization is reproducible.
+type Initializer func(rng *rand.Rand, fanIn int, fanOut int) []float64
+
+func UniformInit(min float64, max float64) Initializer {
+	return func(rng *rand.Rand, fanIn int, fanOut int) []float64 {
+		values := make([]float64, fanIn*fanOut)
+		for i := range values {
+			values[i] = min + rng.Float64()*(max-min)
+		}
+		return values
+	}
+}
+
+func NormalInit(mean float64, stdDev float64) Initializer {
+	return func(rng *rand.Rand, fanIn int, fanOut int) []float64 {
+		values := make([]float64, fanIn*fanOut)
+		for i := range values {
+			values[i] = mean + rng.NormFloat64()*stdDev
+		}
+		return values
+	}
+}
+
+// Uniform in [-limit, limit], limit depending on the fans
+func scaledUniformInit(limit func(fanIn int, fanOut int) float64) Initializer {
+	return func(rng *rand.Rand, fanIn int, fanOut int) []float64 {
+		l := limit(fanIn, fanOut)
+		return UniformInit(-l, l)(rng, fanIn, fanOut)
+	}
+}
+
+// Centered normal, the standard deviation depending on the fans
+func scaledNormalInit(stdDev func(fanIn int, fanOut int) float64) Initializer {
+	return func(rng *rand.Rand, fanIn int, fanOut int) []float64 {
+		return NormalInit(0, stdDev(fanIn, fanOut))(rng, fanIn, fanOut)
+	}
+}
+
+// Fills the weights with an orthogonal matrix (or with orthonormal rows/columns if it is not square), multiplied by gain.
+// See https://arxiv.org/abs/1312.6120.
+func OrthogonalInit(gain float64) Initializer {
+	return func(rng *rand.Rand, fanIn int, fanOut int) []float64 {
+		// The QR decomposition needs at least as many rows as columns, so it's done on the transpose if needed
+		rows, cols := fanIn, fanOut
+		if rows < cols {
+			rows, cols = cols, rows
+		}
+		a := mat.NewDense(rows, cols, NormalInit(0, 1)(rng, rows, cols))
+		var qr mat.QR
+		qr.Factorize(a)
+		var q, r mat.Dense
+		qr.QTo(&q)
+		qr.RTo(&r)
+
+		values := make([]float64, fanIn*fanOut)
+		for i := 0; i < rows; i++ {
+			for j := 0; j < cols; j++ {
+				// Making the decomposition unique, so that the result is uniformly distributed
+				v := gain * q.At(i, j)
+				if r.At(j, j) < 0 {
+					v = -v
+				}
+				if fanIn >= fanOut {
+					values[i*fanOut+j] = v
+				} else {
+					values[j*fanOut+i] = v
+				}
+			}
+		}
+		return values
+	}
+}
+
+func ConstantInit(value float64) Initializer {
+	return func(rng *rand.Rand, fanIn int, fanOut int) []float64 {
+		values := make([]float64, fanIn*fanOut)
+		for i := range values {
+			values[i] = value
+		}
+		return values
+	}
+}
+
+var (
+	ZerosInit = ConstantInit(0)
+	// Glorot & Bengio, see http://proceedings.mlr.press/v9/glorot10a.html. Suited for Sigmoid, Tanh and Softmax.
+	XavierUniformInit = scaledUniformInit(func(fanIn int, fanOut int) float64 { return math.Sqrt(6 / float64(fanIn+fanOut)) })
+	XavierNormalInit  = scaledNormalInit(func(fanIn int, fanOut int) float64 { return math.Sqrt(2 / float64(fanIn+fanOut)) })
+	// He et al., see https://arxiv.org/abs/1502.01852. Suited for ReLU.
+	HeUniformInit = scaledUniformInit(func(fanIn int, fanOut int) float64 { return math.Sqrt(6 / float64(fanIn)) })
+	HeNormalInit  = scaledNormalInit(func(fanIn int, fanOut int) float64 { return math.Sqrt(2 / float64(fanIn)) })
+	// LeCun et al., see http://yann.lecun.com/exdb/publis/pdf/lecun-98b.pdf. Suited for SELU.
+	LeCunUniformInit = scaledUniformInit(func(fanIn int, fanOut int) float64 { return math.Sqrt(3 / float64(fanIn)) })
+	LeCunNormalInit  = scaledNormalInit(func(fanIn int, fanOut int) float64 { return math.Sqrt(1 / float64(fanIn)) })
+)
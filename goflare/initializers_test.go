@@ -0,0 +1,60 @@
+package goflare
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitializers(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("Reproducible with a seeded source", func(t *testing.T) {
+		newLayer := func() *DenseLayer {
+			return NewDenseLayer(5, 3, ReLU, WithInitializer(HeNormalInit), WithRand(rand.New(rand.NewSource(42))))
+		}
+		assert.Equal(newLayer().Weights, newLayer().Weights)
+	})
+
+	t.Run("Scaled ranges", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(42))
+		limit := math.Sqrt(6.0 / 30)
+		for _, w := range XavierUniformInit(rng, 10, 20) {
+			assert.LessOrEqual(math.Abs(w), limit)
+		}
+		assert.Equal([]float64{0, 0, 0, 0}, ZerosInit(rng, 2, 2))
+		assert.Equal([]float64{0.5, 0.5}, ConstantInit(0.5)(rng, 1, 2))
+	})
+
+	t.Run("Orthogonal", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(42))
+		for _, shape := range [][2]int{{4, 4}, {6, 3}, {3, 6}} {
+			fanIn, fanOut := shape[0], shape[1]
+			w := OrthogonalInit(1)(rng, fanIn, fanOut)
+			// The smallest dimension must be orthonormal
+			if fanIn >= fanOut {
+				for a := 0; a < fanOut; a++ {
+					for b := 0; b < fanOut; b++ {
+						dot := float64(0)
+						for i := 0; i < fanIn; i++ {
+							dot += w[i*fanOut+a] * w[i*fanOut+b]
+						}
+						assert.InDelta(map[bool]float64{true: 1, false: 0}[a == b], dot, 1e-9)
+					}
+				}
+			} else {
+				for a := 0; a < fanIn; a++ {
+					for b := 0; b < fanIn; b++ {
+						dot := float64(0)
+						for j := 0; j < fanOut; j++ {
+							dot += w[a*fanOut+j] * w[b*fanOut+j]
+						}
+						assert.InDelta(map[bool]float64{true: 1, false: 0}[a == b], dot, 1e-9)
+					}
+				}
+			}
+		}
+	})
+}
@@ -1,78 +1,102 @@
 package goflare
 
 import (
-	"math/rand"
+	"fmt"
+	"reflect"
 
 	"github.com/jjunac/goflare/utils"
+
+	"gonum.org/v1/gonum/mat"
 )
 
-type Layer struct {
-	NodesIn    int
-	NodesOut   int
-	Weights    [][]float64
-	Biases     []float64
-	Activation ActivationFunc
+// A Layer is a step of the network, transforming InputSize() values into OutputSize() values.
+// Its trainable parameters are exposed as a list of slices, that the optimizers update in place.
+type Layer interface {
+	InputSize() int
+	OutputSize() int
+	// Computes the outputs of the layer
+	Evaluate(inputs []float64) (outputs []float64)
+	// Same as Evaluate, but also stores in learnData what is needed by Backward
+	EvaluateWithLearnData(inputs []float64, learnData *LayerLearnData) (outputs []float64)
+	// Takes the derivative of the loss w.r.t. the outputs, accumulates the derivative of the loss w.r.t. each
+	// parameter into gradients (shaped like Parameters()) and returns the derivative of the loss w.r.t. the inputs.
+	// learnData must have been filled by EvaluateWithLearnData.
+	Backward(outputsGradient []float64, learnData *LayerLearnData, gradients [][]float64) (inputsGradient []float64)
+	// Returns the trainable parameters. The slices are shared with the layer, not copied.
+	Parameters() [][]float64
+	// Returns a new layer with the same param, without sharing any object, even slices.
+	// Useful to avoid sharing when working in parallel
+	Copy() Layer
+	// Re-initializes the parameters
+	Reset()
 }
 
-func NewLayer(nodesIn int, nodesOut int, activation ActivationFunc) Layer {
-	l := Layer{
-		nodesIn,
-		nodesOut,
-		utils.MakeSlice2d[float64](nodesIn, nodesOut),
-		make([]float64, nodesOut),
-		activation,
-	}
-	l.Reset()
-	return l
+// A layer whose outputs are the activation of intermediate values (the "weighted values").
+// The backpropagation can then start directly from the derivative of the loss w.r.t. these values, which allows
+// computing the derivatives of the loss and the activation together (see FusedLoss).
+type ActivatedLayer interface {
+	Layer
+	OutputActivation() *ActivationFunc
+	// Same as Layer.Backward, but takes the derivative of the loss w.r.t. the weighted values
+	BackwardWeighted(weightedGradient []float64, learnData *LayerLearnData, gradients [][]float64) (inputsGradient []float64)
 }
 
-// Returns a new layer with the same param as the other, without sharing any object, even slices.
-// Useful to avoid sharing when working in parallel
-func CopyLayer(src *Layer) Layer {
-	dst := Layer{
-		src.NodesIn,
-		src.NodesOut,
-		utils.Copy2dSlice(src.Weights),
-		utils.CopySlice(src.Biases),
-		src.Activation,
-	}
-	return dst
+// A layer able to process a whole batch at once, the data points being the rows of the matrices.
+// This allows using matrix-matrix products, which are much faster than a product per data point.
+type BatchLayer interface {
+	Layer
+	EvaluateBatch(inputs *mat.Dense) (outputs *mat.Dense)
+	EvaluateBatchWithLearnData(inputs *mat.Dense, learnData *BatchLayerLearnData) (outputs *mat.Dense)
+	// Same as Layer.Backward, the gradients being accumulated over all the rows
+	BackwardBatch(outputsGradient *mat.Dense, learnData *BatchLayerLearnData, gradients [][]float64) (inputsGradient *mat.Dense)
 }
 
-func (l *Layer) Evaluate(inputs []float64) (outputs []float64) {
-	outputs = make([]float64, l.NodesOut)
-	for out := range outputs {
-		value := l.Biases[out]
-		for in := range l.Weights {
-			value += inputs[in] * l.Weights[in][out]
-		}
-		outputs[out] = l.Activation.F(value)
-	}
-	return
+// Batch counterpart of ActivatedLayer
+type BatchActivatedLayer interface {
+	BatchLayer
+	OutputActivation() *ActivationFunc
+	BackwardWeightedBatch(weightedGradient *mat.Dense, learnData *BatchLayerLearnData, gradients [][]float64) (inputsGradient *mat.Dense)
+}
+
+// A layer whose first parameter (see Layer.Parameters) is a matrix of weights, with one column per output, e.g.
+// DenseLayer. Only these weights are regularized, not e.g. the biases, see Regularization.
+type WeightedLayer interface {
+	Layer
+	// Returns a matrix view of the weights, one row per input. The values are shared with the layer, not copied.
+	WeightsMatrix() *mat.Dense
 }
 
-func (l *Layer) EvaluateWithLearnData(inputs []float64, learnData *LayerLearnData) (outputs []float64) {
-	learnData.Inputs = inputs
-	learnData.WeightedValues = make([]float64, l.NodesOut)
+// Allocates zero-ed slices with the same shape as the parameters of the layer, typically to store gradients
+func NewParametersLike(l Layer) [][]float64 {
+	params := l.Parameters()
+	return utils.InitSlice(len(params), func(i int) []float64 { return make([]float64, len(params[i])) })
+}
+
+var (
+	layerTypes     = make(map[string]func() Layer)
+	layerTypeNames = make(map[reflect.Type]string)
+)
+
+// Makes a kind of layer savable and loadable, under the given name. new must return a pointer to an empty layer, in
+// which the saved layer is unmarshalled with encoding/json.
+// NOTE: This is *NOT* thread safe, it is meant to be called in an init function
+func RegisterLayerType(name string, new func() Layer) {
+	layerTypes[name] = new
+	layerTypeNames[reflect.TypeOf(new())] = name
+}
 
-	outputs = make([]float64, l.NodesOut)
-	for out := range outputs {
-		value := l.Biases[out]
-		for in := range l.Weights {
-			value += inputs[in] * l.Weights[in][out]
-		}
-		learnData.WeightedValues[out] = value
-		outputs[out] = l.Activation.F(value)
+func layerTypeName(l Layer) (string, error) {
+	name, ok := layerTypeNames[reflect.TypeOf(l)]
+	if !ok {
+		return "", fmt.Errorf("layer type %T is not registered", l)
 	}
-	return
+	return name, nil
 }
 
-func (l *Layer) Reset() {
-	for out := range l.Biases {
-		l.Biases[out] = 0
-		for in := range l.Weights {
-			// l.Weights[in][out] = (rand.Float64()*2 - 1) / math.Sqrt(float64(l.NodesIn))
-			l.Weights[in][out] = rand.Float64()*2 - 1
-		}
+func newLayerOfType(name string) (Layer, error) {
+	new, ok := layerTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown layer type %q", name)
 	}
+	return new(), nil
 }
@@ -1,31 +1,67 @@
 package goflare
 
-import "github.com/jjunac/goflare/utils"
+import (
+	"github.com/jjunac/goflare/utils"
+
+	"gonum.org/v1/gonum/mat"
+)
 
 type NetworkLearnData struct {
 	Predicted []float64
 	Actual    []float64
-	LayerData []LayerLearnData
+	// Weight of the data point, see DataPoint.Weight. 1 in NewNetworkLearnData.
+	Weight float64
+	// Optional, derivative of the loss w.r.t. Predicted, before the weighting. Computed from the loss if nil.
+	// Set when computed on the whole batch, see BatchLoss.
+	LossGradient []float64
+	LayerData    []LayerLearnData
 }
 
 func NewNetworkLearnData(n *Network) NetworkLearnData {
 	return NetworkLearnData{
-		LayerData: utils.InitSlice(len(n.Layers), func(i int) LayerLearnData { return NewLayerLearnData(&n.Layers[i]) }),
+		LayerData: utils.InitSlice(len(n.Layers), func(i int) LayerLearnData { return NewLayerLearnData(n.Layers[i]) }),
 		Predicted: make([]float64, 0),
 		Actual:    make([]float64, 0),
+		Weight:    1,
 	}
 }
 
 type LayerLearnData struct {
 	Inputs         []float64
 	WeightedValues []float64
+	Outputs        []float64
 	LossDerivative []float64
 }
 
-func NewLayerLearnData(l *Layer) LayerLearnData {
+func NewLayerLearnData(l Layer) LayerLearnData {
 	return LayerLearnData{
 		Inputs:         make([]float64, 0),
 		WeightedValues: make([]float64, 0),
+		Outputs:        make([]float64, 0),
 		LossDerivative: make([]float64, 0),
 	}
 }
+
+// Batch counterpart of NetworkLearnData, each row of the matrices being a data point
+type BatchLearnData struct {
+	Predicted *mat.Dense
+	Actual    *mat.Dense
+	// Weight of each data point, see DataPoint.Weight. All 1 if nil.
+	Weights []float64
+	// Optional, same as NetworkLearnData.LossGradient
+	LossGradient *mat.Dense
+	LayerData    []BatchLayerLearnData
+}
+
+func NewBatchLearnData(n *Network) BatchLearnData {
+	return BatchLearnData{
+		LayerData: make([]BatchLayerLearnData, len(n.Layers)),
+	}
+}
+
+type BatchLayerLearnData struct {
+	Inputs         *mat.Dense
+	WeightedValues *mat.Dense
+	Outputs        *mat.Dense
+	LossDerivative *mat.Dense
+}
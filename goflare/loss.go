@@ -1,14 +1,163 @@
 package goflare
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 
+	"github.com/jjunac/goflare/utils"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// A Loss measures how far the predicted outputs of a data point are from the actual ones, on the whole output vector.
+// LossFunc adapts the element-wise losses, and VectorLossFunc the ones coupling the outputs.
+// Optional interfaces: WeightedLoss, FusedLoss and BatchLoss.
+type Loss interface {
+	// Name used to resolve the loss, see RegisterLoss
+	LossName() string
+	// Loss of a data point, before its weighting
+	Compute(predicted []float64, actual []float64) float64
+	// Derivative of Compute w.r.t. each predicted value, in a new slice
+	Gradient(predicted []float64, actual []float64) []float64
+}
+
+// A Loss weighting the data points beyond their sample weight, e.g. by class
+type WeightedLoss interface {
+	Loss
+	// Returns the factor applied to the loss of a data point, given its sample weight (see DataPoint.Weight)
+	Weight(actual []float64, sampleWeight float64) float64
+}
+
+// A Loss whose derivative can be combined with the activation of the last layer, see ActivatedLayer
+type FusedLoss interface {
+	Loss
+	// Returns the derivative of the loss w.r.t. the values before the activation, nil if it can't be fused with it
+	FusedGradient(activation string) func(predicted []float64, actual []float64) []float64
+}
+
+// A Loss comparing the data points of a batch with each other, e.g. a contrastive loss. It is computed on the whole
+// batch, before the batch is split between the workers of the NetworkTrainer, and on the whole dataset by
+// Network.AvgLoss and Network.EvaluateMetrics. Compute and Gradient only see a data point alone.
+// NOTE: The weight of each data point multiplies its row of ComputeBatch and GradientBatch
+type BatchLoss interface {
+	Loss
+	// Returns the loss of each data point, before their weighting
+	ComputeBatch(predicted *mat.Dense, actual *mat.Dense) []float64
+	// Returns the derivative of the sum of the losses w.r.t. the predicted values of each data point
+	GradientBatch(predicted *mat.Dense, actual *mat.Dense) *mat.Dense
+}
+
+// Returns the factor applied to the loss of a data point, see WeightedLoss
+func lossWeight(loss Loss, actual []float64, sampleWeight float64) float64 {
+	if wl, ok := loss.(WeightedLoss); ok {
+		return wl.Weight(actual, sampleWeight)
+	}
+	return sampleWeight
+}
+
+// Returns the loss of a data point, weighted by its sample weight and the loss own weighting
+func weightedLoss(loss Loss, predicted []float64, actual []float64, sampleWeight float64) float64 {
+	return lossWeight(loss, actual, sampleWeight) * loss.Compute(predicted, actual)
+}
+
+// Returns nil if the loss can't be fused with the activation, see FusedLoss
+func fusedGradient(loss Loss, activation string) func(predicted []float64, actual []float64) []float64 {
+	if fl, ok := loss.(FusedLoss); ok {
+		return fl.FusedGradient(activation)
+	}
+	return nil
+}
+
+// Returns the sum of the weighted losses of the data points, computed at once. The sample weights are all 1 if nil.
+func sumBatchLoss(loss BatchLoss, predicted *mat.Dense, actual *mat.Dense, sampleWeights []float64) (sum float64) {
+	for i, l := range loss.ComputeBatch(predicted, actual) {
+		sum += lossWeight(loss, actual.RawRowView(i), weightAt(sampleWeights, i)) * l
+	}
+	return
+}
+
+// Element-wise loss: the loss of a data point is the sum of the loss of each output
 type LossFunc struct {
 	Name   string
 	F      func(predicted float64, actual float64) float64
 	FPrime func(predicted float64, actual float64) float64
+	// Optional, indexed by activation name: derivative of the loss w.r.t. the values before the activation of the last
+	// layer. Combining both derivatives is often simpler and numerically more stable (e.g. Softmax + CrossEntropy).
+	FusedPrime map[string]func(predicted []float64, actual []float64) []float64
+	// Optional, multiplies the loss of the data points of each class (see classKey), e.g. to emphasize a minority
+	// class. See WithClassWeights and BalancedClassWeights.
+	ClassWeights []float64
+}
+
+// Returns a copy of the loss, weighting the classes
+func (lf LossFunc) WithClassWeights(classWeights []float64) LossFunc {
+	lf.ClassWeights = classWeights
+	return lf
+}
+
+// Returns class weights inversely proportional to the frequency of each class in the dataset, so that each class
+// weighs as much in the total loss: nbDataPoints / (nbClasses * nbDataPointsOfTheClass).
+// NOTE: The classes are expected to be 0, 1, ... N-1, e.g. one-hot outputs
+func BalancedClassWeights(dataset Dataset) []float64 {
+	counts := make([]int, 0)
+	for i := range dataset {
+		class := int(classKey(dataset[i]))
+		for len(counts) <= class {
+			counts = append(counts, 0)
+		}
+		counts[class]++
+	}
+	nbClasses := 0
+	for _, c := range counts {
+		if c > 0 {
+			nbClasses++
+		}
+	}
+	weights := make([]float64, len(counts))
+	for class, c := range counts {
+		if c > 0 {
+			weights[class] = float64(len(dataset)) / float64(nbClasses*c)
+		}
+	}
+	return weights
+}
+
+// Returns the factor applied to the loss of a data point, combining its sample weight and its class weight
+func (lf LossFunc) Weight(actual []float64, sampleWeight float64) float64 {
+	if lf.ClassWeights == nil {
+		return sampleWeight
+	}
+	class := int(classKey(DataPoint{Outputs: actual}))
+	if class < 0 || class >= len(lf.ClassWeights) {
+		return sampleWeight
+	}
+	return sampleWeight * lf.ClassWeights[class]
+}
+
+func (lf LossFunc) LossName() string {
+	return lf.Name
+}
+
+func (lf LossFunc) Compute(predicted []float64, actual []float64) float64 {
+	sum := float64(0)
+	for i := range predicted {
+		sum += lf.F(predicted[i], actual[i])
+	}
+	return sum
+}
+
+func (lf LossFunc) Gradient(predicted []float64, actual []float64) []float64 {
+	return lf.PrimeVectorized(predicted, actual)
+}
+
+func (lf LossFunc) FusedGradient(activation string) func(predicted []float64, actual []float64) []float64 {
+	return lf.FusedPrime[activation]
 }
 
-func (lf *LossFunc) Vectorized(predicted []float64, actual []float64) []float64 {
+func (lf LossFunc) Vectorized(predicted []float64, actual []float64) []float64 {
 	res := make([]float64, len(predicted))
 	for i := range res {
 		res[i] = lf.F(predicted[i], actual[i])
@@ -16,7 +165,7 @@ func (lf *LossFunc) Vectorized(predicted []float64, actual []float64) []float64
 	return res
 }
 
-func (lf *LossFunc) PrimeVectorized(predicted []float64, actual []float64) []float64 {
+func (lf LossFunc) PrimeVectorized(predicted []float64, actual []float64) []float64 {
 	res := make([]float64, len(predicted))
 	for i := range res {
 		res[i] = lf.FPrime(predicted[i], actual[i])
@@ -28,15 +177,458 @@ func (f *LossFunc) MarshalJSON() ([]byte, error) {
 	return json.Marshal(f.Name)
 }
 
+// Resolves the loss from its name, see RegisterLoss
+func (f *LossFunc) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	loss, err := LossByName(name)
+	if err != nil {
+		return err
+	}
+	lf, ok := loss.(LossFunc)
+	if !ok {
+		return fmt.Errorf("loss %q is not element-wise", name)
+	}
+	*f = lf
+	return nil
+}
+
+var (
+	lossRegistry       = make(map[string]Loss)
+	lossFamilyRegistry = make(map[string]func(params ...float64) (Loss, error))
+)
+
+func init() {
+	for _, loss := range []Loss{MSELoss, CrossEntropyLoss, BinaryCrossEntropyLoss, BinaryCrossEntropyFromLogitsLoss, MAELoss, LogCoshLoss, HingeLoss, SquaredHingeLoss, KLDivergenceLoss, SoftmaxCrossEntropyFromLogitsLoss, CosineSimilarityLoss} {
+		RegisterLoss(loss)
+	}
+	lossRegistry["CategoricalCrossEntropy"] = CrossEntropyLoss
+	lossRegistry["L1"] = MAELoss
+	lossRegistry["SmoothL1"] = HuberLoss
+	RegisterLossFamily("Huber", func(params ...float64) (Loss, error) {
+		if len(params) != 1 || params[0] <= 0 {
+			return nil, fmt.Errorf("expected a positive delta, got %v", params)
+		}
+		return NewHuberLoss(params[0]), nil
+	})
+	RegisterLossFamily("Contrastive", func(params ...float64) (Loss, error) {
+		if len(params) != 1 || params[0] <= 0 {
+			return nil, fmt.Errorf("expected a positive margin, got %v", params)
+		}
+		return NewContrastiveLoss(params[0]), nil
+	})
+	RegisterLossFamily("Focal", func(params ...float64) (Loss, error) {
+		if len(params) != 2 {
+			return nil, fmt.Errorf("expected alpha and gamma, got %v", params)
+		}
+		return NewFocalLoss(params[0], params[1]), nil
+	})
+}
+
+// Makes a loss resolvable by its name, typically to load a saved checkpoint using it.
+// NOTE: This is *NOT* thread safe, it is meant to be called in an init function
+func RegisterLoss(loss Loss) {
+	lossRegistry[loss.LossName()] = loss
+}
+
+// Makes the losses parameterized by floats resolvable by their name, which must be "<family>(<param>, ...)",
+// e.g. "Focal(0.25, 2)". new must return losses named this way.
+// NOTE: This is *NOT* thread safe, it is meant to be called in an init function
+func RegisterLossFamily(family string, new func(params ...float64) (Loss, error)) {
+	lossFamilyRegistry[family] = new
+}
+
+func LossByName(name string) (Loss, error) {
+	if loss, ok := lossRegistry[name]; ok {
+		return loss, nil
+	}
+	if family, params, ok := strings.Cut(name, "("); ok && strings.HasSuffix(params, ")") {
+		if new, ok := lossFamilyRegistry[family]; ok {
+			values := make([]float64, 0)
+			for _, param := range strings.Split(strings.TrimSuffix(params, ")"), ",") {
+				v, err := strconv.ParseFloat(strings.TrimSpace(param), 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid parameter in loss %q: %w", name, err)
+				}
+				values = append(values, v)
+			}
+			loss, err := new(values...)
+			if err != nil {
+				return nil, fmt.Errorf("invalid parameters in loss %q: %w", name, err)
+			}
+			return loss, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown loss %q", name)
+}
+
+// Avoids log(0) when a prediction saturates
+const crossEntropyEpsilon = 1e-12
+
 var (
 	MSELoss = LossFunc{
-		"MSE",
-		func(predicted float64, actual float64) float64 {
+		Name: "MSE",
+		F: func(predicted float64, actual float64) float64 {
 			delta := predicted - actual
 			return delta * delta
 		},
-		func(predicted float64, actual float64) float64 {
+		FPrime: func(predicted float64, actual float64) float64 {
 			return 2 * (predicted - actual)
 		},
 	}
+	// Categorical cross-entropy, expecting one-hot (or probability distribution) actual values.
+	// Typically used with a Softmax last layer.
+	CrossEntropyLoss = LossFunc{
+		Name: "CrossEntropy",
+		F: func(predicted float64, actual float64) float64 {
+			return -actual * math.Log(math.Max(predicted, crossEntropyEpsilon))
+		},
+		FPrime: func(predicted float64, actual float64) float64 {
+			return -actual / math.Max(predicted, crossEntropyEpsilon)
+		},
+		FusedPrime: map[string]func(predicted []float64, actual []float64) []float64{
+			"Softmax": func(predicted []float64, actual []float64) []float64 {
+				res := make([]float64, len(predicted))
+				for i := range res {
+					res[i] = predicted[i] - actual[i]
+				}
+				return res
+			},
+		},
+	}
+	// Binary cross-entropy, expecting actual values in [0, 1] and predicted probabilities, e.g. from a Sigmoid last layer
+	BinaryCrossEntropyLoss = LossFunc{
+		Name: "BinaryCrossEntropy",
+		F: func(predicted float64, actual float64) float64 {
+			p := clampProbability(predicted)
+			return -actual*math.Log(p) - (1-actual)*math.Log(1-p)
+		},
+		FPrime: func(predicted float64, actual float64) float64 {
+			p := clampProbability(predicted)
+			return (p - actual) / (p * (1 - p))
+		},
+		FusedPrime: map[string]func(predicted []float64, actual []float64) []float64{
+			"Sigmoid": func(predicted []float64, actual []float64) []float64 {
+				res := make([]float64, len(predicted))
+				for i := range res {
+					res[i] = predicted[i] - actual[i]
+				}
+				return res
+			},
+		},
+	}
+	// Same as BinaryCrossEntropyLoss, but the predicted values are logits, i.e. before the sigmoid.
+	// Typically used with a Linear last layer, it is more numerically stable than Sigmoid + BinaryCrossEntropyLoss.
+	BinaryCrossEntropyFromLogitsLoss = LossFunc{
+		Name: "BinaryCrossEntropyFromLogits",
+		F: func(predicted float64, actual float64) float64 {
+			// Same as the cross-entropy of sigmoid(predicted), without overflowing exp
+			return math.Max(predicted, 0) - predicted*actual + math.Log1p(math.Exp(-math.Abs(predicted)))
+		},
+		FPrime: func(predicted float64, actual float64) float64 {
+			return 1/(1+math.Exp(-predicted)) - actual
+		},
+	}
+	// Mean absolute error, also known as L1. Less sensitive to outliers than MSELoss.
+	MAELoss = LossFunc{
+		Name: "MAE",
+		F: func(predicted float64, actual float64) float64 {
+			return math.Abs(predicted - actual)
+		},
+		FPrime: func(predicted float64, actual float64) float64 {
+			switch {
+			case predicted > actual:
+				return 1
+			case predicted < actual:
+				return -1
+			default:
+				return 0
+			}
+		},
+	}
+	// Same as NewHuberLoss(1), which is also SmoothL1
+	HuberLoss = NewHuberLoss(1)
+	// log(cosh(predicted - actual)): close to MSELoss / 2 for small errors, and to MAELoss for large ones
+	LogCoshLoss = LossFunc{
+		Name: "LogCosh",
+		F: func(predicted float64, actual float64) float64 {
+			// Same as log(cosh(x)), without overflowing cosh
+			x := math.Abs(predicted - actual)
+			return x + math.Log1p(math.Exp(-2*x)) - math.Ln2
+		},
+		FPrime: func(predicted float64, actual float64) float64 {
+			return math.Tanh(predicted - actual)
+		},
+	}
+	// max(0, 1 - actual * predicted), expecting actual values in {-1, 1}, e.g. for a maximum-margin classifier
+	HingeLoss = LossFunc{
+		Name: "Hinge",
+		F: func(predicted float64, actual float64) float64 {
+			return math.Max(0, 1-actual*predicted)
+		},
+		FPrime: func(predicted float64, actual float64) float64 {
+			if actual*predicted < 1 {
+				return -actual
+			}
+			return 0
+		},
+	}
+	// max(0, 1 - actual * predicted)², see HingeLoss
+	SquaredHingeLoss = LossFunc{
+		Name: "SquaredHinge",
+		F: func(predicted float64, actual float64) float64 {
+			margin := math.Max(0, 1-actual*predicted)
+			return margin * margin
+		},
+		FPrime: func(predicted float64, actual float64) float64 {
+			return -2 * actual * math.Max(0, 1-actual*predicted)
+		},
+	}
+	// Kullback-Leibler divergence of the predicted distribution from the actual one: sum(actual * log(actual / predicted))
+	KLDivergenceLoss = LossFunc{
+		Name: "KLDivergence",
+		F: func(predicted float64, actual float64) float64 {
+			if actual <= 0 {
+				return 0
+			}
+			return actual * math.Log(actual/math.Max(predicted, crossEntropyEpsilon))
+		},
+		FPrime: func(predicted float64, actual float64) float64 {
+			return -actual / math.Max(predicted, crossEntropyEpsilon)
+		},
+		FusedPrime: map[string]func(predicted []float64, actual []float64) []float64{
+			// The actual values summing to 1, the derivative is the same as the cross-entropy one
+			"Softmax": CrossEntropyLoss.FusedPrime["Softmax"],
+		},
+	}
+)
+
+func clampProbability(p float64) float64 {
+	return math.Min(math.Max(p, crossEntropyEpsilon), 1-crossEntropyEpsilon)
+}
+
+// Quadratic for errors smaller than delta, linear beyond, like a mix of MSELoss and MAELoss:
+// 0.5 * x² if |x| <= delta, delta * (|x| - 0.5 * delta) otherwise
+func NewHuberLoss(delta float64) LossFunc {
+	return LossFunc{
+		Name: fmt.Sprintf("Huber(%g)", delta),
+		F: func(predicted float64, actual float64) float64 {
+			x := math.Abs(predicted - actual)
+			if x <= delta {
+				return 0.5 * x * x
+			}
+			return delta * (x - 0.5*delta)
+		},
+		FPrime: func(predicted float64, actual float64) float64 {
+			x := predicted - actual
+			return math.Max(-delta, math.Min(delta, x))
+		},
+	}
+}
+
+// Binary cross-entropy down-weighting the well classified data points, to focus on the hard ones, e.g. with a strong
+// class imbalance. Each output is a probability (e.g. from a Sigmoid), alpha weighs the positive class and 1 - alpha
+// the negative one, and gamma >= 0 sets how much the easy data points are down-weighted (0 is the cross-entropy).
+// See https://arxiv.org/abs/1708.02002
+func NewFocalLoss(alpha float64, gamma float64) LossFunc {
+	return LossFunc{
+		Name: fmt.Sprintf("Focal(%g, %g)", alpha, gamma),
+		F: func(predicted float64, actual float64) float64 {
+			p := clampProbability(predicted)
+			return -actual*alpha*math.Pow(1-p, gamma)*math.Log(p) - (1-actual)*(1-alpha)*math.Pow(p, gamma)*math.Log(1-p)
+		},
+		FPrime: func(predicted float64, actual float64) float64 {
+			p := clampProbability(predicted)
+			positive := alpha * (gamma*math.Pow(1-p, gamma-1)*math.Log(p) - math.Pow(1-p, gamma)/p)
+			negative := (1 - alpha) * (math.Pow(p, gamma)/(1-p) - gamma*math.Pow(p, gamma-1)*math.Log(1-p))
+			return actual*positive + (1-actual)*negative
+		},
+	}
+}
+
+// Loss coupling the outputs of a data point, e.g. comparing the whole vectors
+type VectorLossFunc struct {
+	Name   string
+	F      func(predicted []float64, actual []float64) float64
+	FPrime func(predicted []float64, actual []float64) []float64
+	// Optional, same as LossFunc.FusedPrime
+	FusedPrime map[string]func(predicted []float64, actual []float64) []float64
+}
+
+func (lf VectorLossFunc) LossName() string {
+	return lf.Name
+}
+
+func (lf VectorLossFunc) Compute(predicted []float64, actual []float64) float64 {
+	return lf.F(predicted, actual)
+}
+
+func (lf VectorLossFunc) Gradient(predicted []float64, actual []float64) []float64 {
+	return lf.FPrime(predicted, actual)
+}
+
+func (lf VectorLossFunc) FusedGradient(activation string) func(predicted []float64, actual []float64) []float64 {
+	return lf.FusedPrime[activation]
+}
+
+var (
+	// Same as Softmax + CrossEntropyLoss, but the predicted values are logits, i.e. before the softmax.
+	// Typically used with a Linear last layer.
+	SoftmaxCrossEntropyFromLogitsLoss = VectorLossFunc{
+		Name: "SoftmaxCrossEntropyFromLogits",
+		F: func(predicted []float64, actual []float64) float64 {
+			// -sum(actual_i * log(softmax_i)), with log(softmax_i) = predicted_i - log(sum(exp(predicted_j)))
+			max := math.Inf(-1)
+			for _, v := range predicted {
+				max = math.Max(max, v)
+			}
+			sumExp := float64(0)
+			for _, v := range predicted {
+				sumExp += math.Exp(v - max)
+			}
+			logSumExp := max + math.Log(sumExp)
+			loss := float64(0)
+			for i := range predicted {
+				loss += actual[i] * (logSumExp - predicted[i])
+			}
+			return loss
+		},
+		FPrime: func(predicted []float64, actual []float64) []float64 {
+			res := Softmax.VectorF(predicted)
+			total := utils.Sum(actual)
+			for i := range res {
+				res[i] = res[i]*total - actual[i]
+			}
+			return res
+		},
+	}
+	// 1 - cos(predicted, actual): only the direction of the outputs matters, not their norm, e.g. for embeddings
+	CosineSimilarityLoss = VectorLossFunc{
+		Name: "CosineSimilarity",
+		F: func(predicted []float64, actual []float64) float64 {
+			dot, predictedNorm, actualNorm := cosineTerms(predicted, actual)
+			if predictedNorm == 0 || actualNorm == 0 {
+				return 1
+			}
+			return 1 - dot/(predictedNorm*actualNorm)
+		},
+		FPrime: func(predicted []float64, actual []float64) []float64 {
+			dot, predictedNorm, actualNorm := cosineTerms(predicted, actual)
+			res := make([]float64, len(predicted))
+			if predictedNorm == 0 || actualNorm == 0 {
+				return res
+			}
+			cos := dot / (predictedNorm * actualNorm)
+			for i := range res {
+				res[i] = cos*predicted[i]/(predictedNorm*predictedNorm) - actual[i]/(predictedNorm*actualNorm)
+			}
+			return res
+		},
+	}
 )
+
+// Returns the dot product of the vectors, and their norms
+func cosineTerms(a []float64, b []float64) (dot float64, aNorm float64, bNorm float64) {
+	for i := range a {
+		dot += a[i] * b[i]
+		aNorm += a[i] * a[i]
+		bNorm += b[i] * b[i]
+	}
+	return dot, math.Sqrt(aNorm), math.Sqrt(bNorm)
+}
+
+// Pulls together the predicted outputs (e.g. embeddings, with a Linear last layer) of the data points of the same
+// class, and pushes apart the ones of different classes until their distance reaches Margin. The class of a data point
+// comes from its actual outputs, see classKey.
+// Each data point is compared with the others of its batch: its loss is the average of d² / 2 for the ones of the same
+// class, and max(0, Margin - d)² / 2 for the others, d being the euclidean distance of their predicted outputs.
+// See http://yann.lecun.com/exdb/publis/pdf/hadsell-chopra-lecun-06.pdf
+type ContrastiveLoss struct {
+	Margin float64
+}
+
+func NewContrastiveLoss(margin float64) ContrastiveLoss {
+	return ContrastiveLoss{Margin: margin}
+}
+
+func (l ContrastiveLoss) LossName() string {
+	return fmt.Sprintf("Contrastive(%g)", l.Margin)
+}
+
+// A data point alone has nothing to be compared with
+func (l ContrastiveLoss) Compute(predicted []float64, actual []float64) float64 {
+	return 0
+}
+
+func (l ContrastiveLoss) Gradient(predicted []float64, actual []float64) []float64 {
+	return make([]float64, len(predicted))
+}
+
+func (l ContrastiveLoss) ComputeBatch(predicted *mat.Dense, actual *mat.Dense) []float64 {
+	rows, _ := predicted.Dims()
+	losses := make([]float64, rows)
+	if rows < 2 {
+		return losses
+	}
+	classes := l.classes(actual)
+	for i := 0; i < rows; i++ {
+		for j := i + 1; j < rows; j++ {
+			d := math.Sqrt(squaredDistance(predicted.RawRowView(i), predicted.RawRowView(j)))
+			pair := d * d
+			if classes[i] != classes[j] {
+				pair = math.Pow(math.Max(0, l.Margin-d), 2)
+			}
+			losses[i] += pair / 2
+			losses[j] += pair / 2
+		}
+	}
+	for i := range losses {
+		losses[i] /= float64(rows - 1)
+	}
+	return losses
+}
+
+func (l ContrastiveLoss) GradientBatch(predicted *mat.Dense, actual *mat.Dense) *mat.Dense {
+	rows, cols := predicted.Dims()
+	gradient := mat.NewDense(rows, cols, nil)
+	if rows < 2 {
+		return gradient
+	}
+	classes := l.classes(actual)
+	for i := 0; i < rows; i++ {
+		for j := i + 1; j < rows; j++ {
+			pi, pj := predicted.RawRowView(i), predicted.RawRowView(j)
+			// Derivative of the pair term w.r.t. pi - pj: 2 * (pi - pj) for the same class,
+			// -2 * max(0, Margin - d) * (pi - pj) / d otherwise
+			factor := float64(2)
+			if classes[i] != classes[j] {
+				d := math.Sqrt(squaredDistance(pi, pj))
+				if d == 0 || d >= l.Margin {
+					continue
+				}
+				factor = -2 * (l.Margin - d) / d
+			}
+			factor /= float64(rows - 1)
+			gi, gj := gradient.RawRowView(i), gradient.RawRowView(j)
+			for k := range pi {
+				gi[k] += factor * (pi[k] - pj[k])
+				gj[k] -= factor * (pi[k] - pj[k])
+			}
+		}
+	}
+	return gradient
+}
+
+func (l ContrastiveLoss) classes(actual *mat.Dense) []float64 {
+	rows, _ := actual.Dims()
+	return utils.InitSlice(rows, func(i int) float64 { return classKey(DataPoint{Outputs: actual.RawRowView(i)}) })
+}
+
+func squaredDistance(a []float64, b []float64) (sum float64) {
+	for i := range a {
+		sum += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return
+}
@@ -0,0 +1,153 @@
+package goflare
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/jjunac/goflare/utils"
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestLossesDerivatives(t *testing.T) {
+	assert := assert.New(t)
+	const h = 1e-6
+	probabilities := [][2]float64{{0.2, 0}, {0.7, 0}, {0.3, 1}, {0.9, 1}, {0.4, 0.25}}
+	errors := [][2]float64{{-2.3, 0.5}, {0.1, -0.6}, {1.4, 0.2}, {3.2, -1}}
+	margins := [][2]float64{{-1.3, 1}, {0.4, 1}, {1.6, 1}, {-2.1, -1}, {0.7, -1}}
+	tests := []struct {
+		loss   LossFunc
+		points [][2]float64 // {predicted, actual}, avoiding the points where the derivative is not defined
+	}{
+		{MSELoss, errors},
+		{CrossEntropyLoss, probabilities},
+		{BinaryCrossEntropyLoss, probabilities},
+		{BinaryCrossEntropyFromLogitsLoss, errors},
+		{MAELoss, errors},
+		{HuberLoss, errors},
+		{NewHuberLoss(0.5), errors},
+		{LogCoshLoss, errors},
+		{HingeLoss, margins},
+		{SquaredHingeLoss, margins},
+		{NewFocalLoss(0.25, 2), probabilities},
+		{NewFocalLoss(0.5, 0.5), probabilities},
+		{KLDivergenceLoss, [][2]float64{{0.2, 0.1}, {0.7, 0.4}, {0.5, 0.9}}},
+	}
+	for _, tt := range tests {
+		for _, p := range tt.points {
+			numerical := (tt.loss.F(p[0]+h, p[1]) - tt.loss.F(p[0]-h, p[1])) / (2 * h)
+			assert.InDelta(numerical, tt.loss.FPrime(p[0], p[1]), 1e-5, "%s'(%g, %g)", tt.loss.Name, p[0], p[1])
+		}
+	}
+
+	// The fused derivatives are the chain rule through the activation
+	logits, actual := []float64{-1.2, 0.3, 2.1}, []float64{0, 1, 1}
+	predicted := Sigmoid.Vectorized(logits)
+	assert.InDeltaSlice(
+		Sigmoid.Backward(logits, predicted, BinaryCrossEntropyLoss.PrimeVectorized(predicted, actual)),
+		BinaryCrossEntropyLoss.FusedPrime["Sigmoid"](predicted, actual),
+		1e-9,
+	)
+	assert.InDeltaSlice(BinaryCrossEntropyFromLogitsLoss.PrimeVectorized(logits, actual), BinaryCrossEntropyLoss.FusedPrime["Sigmoid"](predicted, actual), 1e-9)
+	assert.InDelta(BinaryCrossEntropyLoss.F(Sigmoid.F(2.1), 0), BinaryCrossEntropyFromLogitsLoss.F(2.1, 0), 1e-9)
+	// No overflow with large logits
+	assert.InDelta(1000.0, BinaryCrossEntropyFromLogitsLoss.F(1000, 0), 1e-9)
+	assert.InDelta(0.0, BinaryCrossEntropyFromLogitsLoss.F(1000, 1), 1e-9)
+	assert.InDelta(999.0-0.6931471805599453, LogCoshLoss.F(999, 0), 1e-9)
+}
+
+func TestLossByName(t *testing.T) {
+	assert := assert.New(t)
+	for _, name := range []string{"MSE", "CrossEntropy", "BinaryCrossEntropy", "BinaryCrossEntropyFromLogits", "MAE", "Huber(1)", "Huber(0.5)", "LogCosh", "Hinge", "SquaredHinge", "Focal(0.25, 2)", "KLDivergence"} {
+		lf, err := LossByName(name)
+		assert.NoError(err)
+		assert.Equal(name, lf.LossName())
+	}
+	for alias, name := range map[string]string{"CategoricalCrossEntropy": "CrossEntropy", "L1": "MAE", "SmoothL1": "Huber(1)", "Focal(0.25,2)": "Focal(0.25, 2)"} {
+		lf, err := LossByName(alias)
+		assert.NoError(err)
+		assert.Equal(name, lf.LossName())
+	}
+
+	// The parameters are kept when saving and loading
+	var loaded struct{ Loss *LossFunc }
+	saved, err := json.Marshal(struct{ Loss *LossFunc }{&[]LossFunc{NewHuberLoss(2)}[0]})
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(saved, &loaded))
+	assert.Equal(2.0, loaded.Loss.FPrime(5, 0))
+
+	_, err = LossByName("SoftmaxCrossEntropyFromLogits")
+	assert.NoError(err)
+	assert.EqualError(json.Unmarshal([]byte(`{"Loss": "CosineSimilarity"}`), &loaded), `loss "CosineSimilarity" is not element-wise`)
+
+	_, err = LossByName("Huber(x)")
+	assert.ErrorContains(err, `invalid parameter in loss "Huber(x)"`)
+	_, err = LossByName("Focal(0.25)")
+	assert.ErrorContains(err, `invalid parameters in loss "Focal(0.25)"`)
+	_, err = LossByName("Foo")
+	assert.EqualError(err, `unknown loss "Foo"`)
+}
+
+func TestVectorLosses(t *testing.T) {
+	assert := assert.New(t)
+	const h = 1e-6
+	points := [][2][]float64{
+		{{0.3, -1.2, 2.1}, {0, 0, 1}},
+		{{-0.5, 0.8, 0.1}, {0.2, 0.5, 0.3}},
+		{{1.5, 2.5, -0.7}, {1, 0, 0}},
+	}
+	for _, loss := range []Loss{SoftmaxCrossEntropyFromLogitsLoss, CosineSimilarityLoss, MSELoss, HuberLoss} {
+		for _, p := range points {
+			gradient := loss.Gradient(p[0], p[1])
+			for i := range p[0] {
+				plus, minus := utils.CopySlice(p[0]), utils.CopySlice(p[0])
+				plus[i] += h
+				minus[i] -= h
+				numerical := (loss.Compute(plus, p[1]) - loss.Compute(minus, p[1])) / (2 * h)
+				assert.InDelta(numerical, gradient[i], 1e-5, "%s' at %v, output %d", loss.LossName(), p[0], i)
+			}
+		}
+	}
+
+	// The element-wise losses sum the loss of each output
+	assert.InDelta(MSELoss.F(0.3, 0)+MSELoss.F(-1.2, 0)+MSELoss.F(2.1, 1), MSELoss.Compute(points[0][0], points[0][1]), 1e-12)
+	// Same as Softmax + CrossEntropyLoss
+	probabilities := Softmax.VectorF(points[1][0])
+	assert.InDelta(CrossEntropyLoss.Compute(probabilities, points[1][1]), SoftmaxCrossEntropyFromLogitsLoss.Compute(points[1][0], points[1][1]), 1e-9)
+	assert.InDelta(0.0, CosineSimilarityLoss.Compute([]float64{1, 2}, []float64{2, 4}), 1e-12)
+	assert.InDelta(2.0, CosineSimilarityLoss.Compute([]float64{1, 2}, []float64{-2, -4}), 1e-12)
+}
+
+func TestContrastiveLoss(t *testing.T) {
+	assert := assert.New(t)
+	const h = 1e-6
+	loss := NewContrastiveLoss(2)
+	predicted := mat.NewDense(4, 2, []float64{0.1, 0.2, 0.5, -0.3, 1.4, 0.9, -2.5, 1})
+	actual := mat.NewDense(4, 2, []float64{1, 0, 1, 0, 0, 1, 0, 1})
+	total := func() float64 { return utils.Sum(loss.ComputeBatch(predicted, actual)) }
+
+	gradient := loss.GradientBatch(predicted, actual)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 2; j++ {
+			v := predicted.At(i, j)
+			predicted.Set(i, j, v+h)
+			plus := total()
+			predicted.Set(i, j, v-h)
+			minus := total()
+			predicted.Set(i, j, v)
+			assert.InDelta((plus-minus)/(2*h), gradient.At(i, j), 1e-5, "row %d, col %d", i, j)
+		}
+	}
+
+	// Same class: d², different classes: max(0, 2 - d)², shared between both data points and averaged over the 3 others
+	d := func(i, j int) float64 {
+		return math.Hypot(predicted.At(i, 0)-predicted.At(j, 0), predicted.At(i, 1)-predicted.At(j, 1))
+	}
+	expected := (d(0, 1)*d(0, 1) + math.Pow(2-d(0, 2), 2) + 0) / 2 / 3
+	assert.InDelta(expected, loss.ComputeBatch(predicted, actual)[0], 1e-12)
+
+	lf, err := LossByName("Contrastive(2)")
+	assert.NoError(err)
+	assert.Equal(loss, lf)
+}
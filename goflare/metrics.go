@@ -0,0 +1,62 @@
+package goflare
+
+import (
+	"github.com/jjunac/goflare/utils"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// A Metric measures the quality of the predictions of a network, on a whole dataset
+type Metric struct {
+	Name string
+	F    func(predicted [][]float64, actual [][]float64) float64
+}
+
+var (
+	// Proportion of data points whose highest output is the expected class
+	AccuracyMetric = Metric{
+		"accuracy",
+		func(predicted [][]float64, actual [][]float64) float64 {
+			right := 0
+			for i := range predicted {
+				predictedClass, _ := utils.Max(predicted[i])
+				actualClass, _ := utils.Max(actual[i])
+				if predictedClass == actualClass {
+					right++
+				}
+			}
+			return float64(right) / float64(len(predicted))
+		},
+	}
+)
+
+// Evaluates the network on the data, and returns the average loss (as "loss") along with the given metrics.
+// The loss is weighted by the loss itself (e.g. LossFunc.ClassWeights), not by the sample weights.
+func (n *Network) EvaluateMetrics(lossFunc Loss, metrics []Metric, data Dataset) map[string]float64 {
+	predicted := make([][]float64, len(data))
+	actual := make([][]float64, len(data))
+	for i := range data {
+		predicted[i] = n.Evaluate(data[i].Inputs)
+		actual[i] = data[i].Outputs
+	}
+	loss := float64(0)
+	if bl, ok := lossFunc.(BatchLoss); ok && len(data) > 0 {
+		predictedMatrix := mat.NewDense(len(data), len(predicted[0]), nil)
+		for i := range predicted {
+			predictedMatrix.SetRow(i, predicted[i])
+		}
+		_, actualMatrix := data.Matrices()
+		loss = sumBatchLoss(bl, predictedMatrix, actualMatrix, nil)
+	} else {
+		for i := range data {
+			loss += weightedLoss(lossFunc, predicted[i], actual[i], 1)
+		}
+	}
+
+	res := make(map[string]float64, len(metrics)+1)
+	res["loss"] = loss / float64(len(data))
+	for _, m := range metrics {
+		res[m.Name] = m.F(predicted, actual)
+	}
+	return res
+}
@@ -2,6 +2,8 @@ package goflare
 
 import (
 	"github.com/jjunac/goflare/utils"
+
+	"gonum.org/v1/gonum/mat"
 )
 
 type Network struct {
@@ -18,13 +20,18 @@ func NewNetwork(layers []Layer) Network {
 // Useful to avoid sharing when working in parallel
 func CopyNetwork(src *Network) Network {
 	return Network{
-		utils.InitSlice(len(src.Layers), func(i int) Layer { return CopyLayer(&src.Layers[i]) }),
+		utils.InitSlice(len(src.Layers), func(i int) Layer { return src.Layers[i].Copy() }),
 	}
 }
 
-func (n *Network) AvgLoss(lossFunc LossFunc, data Dataset) (loss float64) {
+// Same as the "loss" of EvaluateMetrics
+func (n *Network) AvgLoss(lossFunc Loss, data Dataset) (loss float64) {
+	if bl, ok := lossFunc.(BatchLoss); ok && len(data) > 0 {
+		inputs, actual := data.Matrices()
+		return sumBatchLoss(bl, n.EvaluateBatch(inputs), actual, nil) / float64(len(data))
+	}
 	for i := range data {
-		loss += utils.Sum(lossFunc.Vectorized(n.Evaluate(data[i].Inputs), data[i].Outputs))
+		loss += weightedLoss(lossFunc, n.Evaluate(data[i].Inputs), data[i].Outputs, 1)
 	}
 	loss /= float64(len(data))
 	return
@@ -45,6 +52,41 @@ func (n *Network) EvaluateWithLearnData(inputs []float64, nld *NetworkLearnData)
 	return inputs
 }
 
+// Whether all the layers implement BatchLayer
+func (n *Network) SupportsBatches() bool {
+	for i := range n.Layers {
+		if _, ok := n.Layers[i].(BatchLayer); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Evaluates all the rows of inputs at once. The layers not implementing BatchLayer evaluate them one by one.
+func (n *Network) EvaluateBatch(inputs *mat.Dense) *mat.Dense {
+	for i := range n.Layers {
+		if l, ok := n.Layers[i].(BatchLayer); ok {
+			inputs = l.EvaluateBatch(inputs)
+			continue
+		}
+		rows, _ := inputs.Dims()
+		outputs := mat.NewDense(rows, n.Layers[i].OutputSize(), nil)
+		for row := 0; row < rows; row++ {
+			copy(outputs.RawRowView(row), n.Layers[i].Evaluate(inputs.RawRowView(row)))
+		}
+		inputs = outputs
+	}
+	return inputs
+}
+
+// NOTE: All the layers must implement BatchLayer, see SupportsBatches
+func (n *Network) EvaluateBatchWithLearnData(inputs *mat.Dense, bld *BatchLearnData) *mat.Dense {
+	for i := range n.Layers {
+		inputs = n.Layers[i].(BatchLayer).EvaluateBatchWithLearnData(inputs, &bld.LayerData[i])
+	}
+	return inputs
+}
+
 func (n *Network) Reset() {
 	for i := range n.Layers {
 		n.Layers[i].Reset()
@@ -28,21 +28,29 @@ func BenchmarkNetworkLearn(b *testing.B) {
 		}
 	})
 
-	network := NewNetwork(
-		[]Layer{
-			NewLayer(1000, 500, Sigmoid),
-			NewLayer(500, 200, Sigmoid),
-			NewLayer(200, 50, Sigmoid),
-		},
-	)
-	optimizer := NewOptimizer(&network, MSELoss, 10, 0)
-	loader := NewDataLoader(data, batchSize, true)
-	trainer := NetworkTrainer{NbWorkers: 4}
+	runBench := func(unbatched bool) func(b *testing.B) {
+		return func(b *testing.B) {
+			network := NewNetwork(
+				[]Layer{
+					NewDenseLayer(1000, 500, Sigmoid),
+					NewDenseLayer(500, 200, Sigmoid),
+					NewDenseLayer(200, 50, Sigmoid),
+				},
+			)
+			optimizer := NewSGD(&network, MSELoss, 10, 0)
+			loader := NewDataLoader(data, batchSize, true)
+			trainer := NetworkTrainer{NbWorkers: 4, Unbatched: unbatched}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		trainer.Train(&network, loader, optimizer)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				trainer.Train(&network, loader, optimizer)
+			}
+		}
 	}
+
+	b.Run("batched", runBench(false))
+	// Evaluating the data points one by one
+	b.Run("unbatched", runBench(true))
 }
 
 func BenchmarkNetworkLearnParallel(b *testing.B) {
@@ -68,12 +76,12 @@ func BenchmarkNetworkLearnParallel(b *testing.B) {
 
 			network := NewNetwork(
 				[]Layer{
-					NewLayer(1000, 500, Sigmoid),
-					NewLayer(500, 200, Sigmoid),
-					NewLayer(200, 50, Sigmoid),
+					NewDenseLayer(1000, 500, Sigmoid),
+					NewDenseLayer(500, 200, Sigmoid),
+					NewDenseLayer(200, 50, Sigmoid),
 				},
 			)
-			optimizer := NewOptimizer(&network, MSELoss, 10, 0)
+			optimizer := NewSGD(&network, MSELoss, 10, 0)
 			loader := NewDataLoader(data, batchSize, true)
 			trainer := NetworkTrainer{NbWorkers: nbWorkers}
 
@@ -0,0 +1,93 @@
+package goflare
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Version of the format written by Network.Save, increased on each breaking change:
+//   - 1: initial version
+const networkFormatVersion = 1
+
+type savedNetwork struct {
+	Version   int
+	Layers    []savedLayer
+	Optimizer *OptimizerState `json:",omitempty"`
+}
+
+type savedLayer struct {
+	Type  string
+	Layer json.RawMessage
+}
+
+// Writes the network (layers, parameters and activations) as JSON.
+// The layers and activations must be registered, see RegisterLayerType and RegisterActivation.
+func (n *Network) Save(w io.Writer) error {
+	return n.save(w, nil)
+}
+
+// Same as Save, but also writes the state of the optimizer, so that the training can be resumed with LoadCheckpoint
+func (n *Network) SaveCheckpoint(w io.Writer, optimizer Optimizer) error {
+	state := optimizer.State()
+	return n.save(w, &state)
+}
+
+func (n *Network) save(w io.Writer, optimizerState *OptimizerState) error {
+	saved := savedNetwork{
+		Version:   networkFormatVersion,
+		Layers:    make([]savedLayer, len(n.Layers)),
+		Optimizer: optimizerState,
+	}
+	for i, l := range n.Layers {
+		typeName, err := layerTypeName(l)
+		if err != nil {
+			return fmt.Errorf("cannot save layer %d: %w", i, err)
+		}
+		saved.Layers[i].Type = typeName
+		saved.Layers[i].Layer, err = json.Marshal(l)
+		if err != nil {
+			return fmt.Errorf("cannot save layer %d: %w", i, err)
+		}
+	}
+	if err := json.NewEncoder(w).Encode(saved); err != nil {
+		return fmt.Errorf("cannot save network: %w", err)
+	}
+	return nil
+}
+
+// Reads a network written by Network.Save or Network.SaveCheckpoint
+func LoadNetwork(r io.Reader) (*Network, error) {
+	n, _, err := LoadCheckpoint(r)
+	return n, err
+}
+
+// Reads a network written by Network.SaveCheckpoint, along with the optimizer state (nil if there is none).
+// The state can then be restored with Optimizer.LoadState on an optimizer created for the network.
+func LoadCheckpoint(r io.Reader) (*Network, *OptimizerState, error) {
+	var saved savedNetwork
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return nil, nil, fmt.Errorf("cannot load network: %w", err)
+	}
+	if saved.Version < 1 || saved.Version > networkFormatVersion {
+		return nil, nil, fmt.Errorf("cannot load network: unsupported format version %d", saved.Version)
+	}
+
+	layers := make([]Layer, len(saved.Layers))
+	for i := range saved.Layers {
+		l, err := newLayerOfType(saved.Layers[i].Type)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot load layer %d: %w", i, err)
+		}
+		if err := json.Unmarshal(saved.Layers[i].Layer, l); err != nil {
+			return nil, nil, fmt.Errorf("cannot load layer %d: %w", i, err)
+		}
+		if i > 0 && layers[i-1].OutputSize() != l.InputSize() {
+			return nil, nil, fmt.Errorf("cannot load layer %d: %d inputs, but the previous layer has %d outputs", i, l.InputSize(), layers[i-1].OutputSize())
+		}
+		layers[i] = l
+	}
+
+	n := NewNetwork(layers)
+	return &n, saved.Optimizer, nil
+}
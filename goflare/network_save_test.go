@@ -0,0 +1,55 @@
+package goflare
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetworkSaveLoad(t *testing.T) {
+	assert := assert.New(t)
+	network := NewNetwork([]Layer{
+		NewDenseLayer(3, 4, ReLU),
+		NewDenseLayer(4, 2, Softmax),
+	})
+	inputs := []float64{0.1, -0.4, 0.7}
+
+	t.Run("Round trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(network.Save(&buf))
+		loaded, err := LoadNetwork(&buf)
+		assert.NoError(err)
+		assert.Equal(network.Evaluate(inputs), loaded.Evaluate(inputs))
+		assert.Equal("Softmax", loaded.Layers[1].(*DenseLayer).Activation.Name)
+	})
+
+	t.Run("Round trip with optimizer state", func(t *testing.T) {
+		optimizer := NewAdam(&network, CrossEntropyLoss, 0.01)
+		trainer := NetworkTrainer{NbWorkers: 1}
+		trainer.Train(&network, NewDataLoader(Dataset{{Inputs: inputs, Outputs: []float64{0, 1}}}, 1, false), optimizer)
+
+		var buf bytes.Buffer
+		assert.NoError(network.SaveCheckpoint(&buf, optimizer))
+		loaded, state, err := LoadCheckpoint(&buf)
+		assert.NoError(err)
+		// The learning rates come from the state, not from the constructor
+		loadedOptimizer := NewAdam(loaded, CrossEntropyLoss, 0.5)
+		assert.NoError(loadedOptimizer.LoadState(*state))
+		assert.Equal(optimizer.State(), loadedOptimizer.State())
+		assert.Equal(0.01, loadedOptimizer.State().InitialLearnRate)
+		assert.Error(NewSGD(loaded, CrossEntropyLoss, 0.01, 0).LoadState(*state))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := LoadNetwork(strings.NewReader(`{"Version":42,"Layers":[]}`))
+		assert.ErrorContains(err, "unsupported format version 42")
+		_, err = LoadNetwork(strings.NewReader(`{"Version":1,"Layers":[{"Type":"Foo","Layer":{}}]}`))
+		assert.ErrorContains(err, `unknown layer type "Foo"`)
+		_, err = LoadNetwork(strings.NewReader(`{"Version":1,"Layers":[{"Type":"Dense","Layer":{"NodesIn":1,"NodesOut":1,"Weights":[1],"Biases":[0],"Activation":"Foo"}}]}`))
+		assert.ErrorContains(err, `unknown activation "Foo"`)
+		_, err = LoadNetwork(strings.NewReader(`{"Version":1,"Layers":[{"Type":"Dense","Layer":{"NodesIn":2,"NodesOut":1,"Weights":[1],"Biases":[0],"Activation":"ReLU"}}]}`))
+		assert.ErrorContains(err, "dense layer 2x1 has 1 weights and 1 biases")
+	})
+}
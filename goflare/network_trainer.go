@@ -1,14 +1,19 @@
 package goflare
 
 import (
+	"fmt"
 	"runtime"
 	"sync"
 
 	"github.com/jjunac/goflare/utils"
+
+	"gonum.org/v1/gonum/mat"
 )
 
 type NetworkTrainer struct {
 	NbWorkers int
+	// Forces evaluating the data points one by one, even when all the layers implement BatchLayer
+	Unbatched bool
 }
 
 func (nt *NetworkTrainer) nbWorkers() int {
@@ -18,58 +23,245 @@ func (nt *NetworkTrainer) nbWorkers() int {
 	// Don't exactly know why, but NumCPU actually make the program slower.
 	// It could be io bound, cache miss because of sharing/false-sharing, hyper threading, ...
 	// TODO: Investigate
+	if runtime.NumCPU() < 2 {
+		return 1
+	}
 	return runtime.NumCPU() / 2
 }
 
-func (nt *NetworkTrainer) Train(n *Network, loader *DataLoader, optimizer *Optimizer) (globalRunningLoss float64) {
-	for _, batch := range loader.Batches() {
-		type learningResult struct {
-			runningLoss float64
-		}
-		dataPointChannel := make(chan *DataPoint, nt.nbWorkers())
-		resultChannel := make(chan *learningResult, nt.nbWorkers())
-		var workerWg sync.WaitGroup
-
-		for i := 0; i < nt.nbWorkers(); i++ {
-			workerWg.Add(1)
-			go optimizer.RunWorker(func(worker *OptimizerWorker) {
-				defer workerWg.Done()
+// Trains the network for an epoch, returning the sum of the losses divided by the batch size.
+// NOTE: The epoch ends early if the loader fails, check loader.Err()
+func (nt *NetworkTrainer) Train(n *Network, loader *DataLoader, optimizer Optimizer) (globalRunningLoss float64) {
+	it := loader.Iter()
+	for batch, ok := it.Next(); ok; batch, ok = it.Next() {
+		globalRunningLoss += nt.trainBatch(n, batch, loader.weighted, optimizer)
+	}
+
+	globalRunningLoss /= float64(loader.batchSize)
+	return
+}
+
+// Learns from a batch and updates the network, returning the sum of the losses of the data points, including their
+// regularization term. weighted applies the sample weights, see WithSampleWeights.
+func (nt *NetworkTrainer) trainBatch(n *Network, batch Dataset, weighted bool, optimizer Optimizer) (runningLoss float64) {
+	if !nt.Unbatched && n.SupportsBatches() {
+		return nt.trainBatchMatrices(n, batch, weighted, optimizer)
+	}
+
+	loss := optimizer.Loss()
+	sampleWeights := batch.sampleWeights(weighted)
+	runningLoss, lossGradients := batchLoss(n, batch, sampleWeights, loss)
+	type learningResult struct {
+		runningLoss float64
+	}
+	dataPointChannel := make(chan int, nt.nbWorkers())
+	resultChannel := make(chan *learningResult, nt.nbWorkers())
+	var workerWg sync.WaitGroup
+
+	for i := 0; i < nt.nbWorkers(); i++ {
+		workerWg.Add(1)
+		// Done must be called after RunWorker integrates the gradients, not inside the worker function
+		go func() {
+			defer workerWg.Done()
+			optimizer.RunWorker(func(worker *OptimizerWorker) {
 				res := learningResult{}
 				nld := NewNetworkLearnData(n)
 				for {
-					data, open := <-dataPointChannel
+					iData, open := <-dataPointChannel
 					if !open {
 						break
 					}
+					data := &batch[iData]
 
 					// --- Evaluation
 					outputs := n.EvaluateWithLearnData(data.Inputs, &nld)
-					res.runningLoss += utils.Sum(optimizer.loss.Vectorized(outputs, data.Outputs))
+					if lossGradients == nil {
+						res.runningLoss += weightedLoss(loss, outputs, data.Outputs, weightAt(sampleWeights, iData))
+					} else {
+						nld.LossGradient = lossGradients.RawRowView(iData)
+					}
 
 					// --- Back-propagation
 					nld.Predicted = outputs
 					nld.Actual = data.Outputs
+					nld.Weight = weightAt(sampleWeights, iData)
 					worker.Backpropagate(&nld)
 				}
 				resultChannel <- &res
 			})
-		}
+		}()
+	}
 
-		for iData := range batch {
-			dataPointChannel <- &batch[iData]
-		}
-		close(dataPointChannel)
+	for iData := range batch {
+		dataPointChannel <- iData
+	}
+	close(dataPointChannel)
+
+	workerWg.Wait()
+
+	close(resultChannel)
+	for res := range resultChannel {
+		runningLoss += res.runningLoss
+	}
+	runningLoss += float64(len(batch)) * optimizer.RegularizationLoss()
+
+	optimizer.Step()
+	return
+}
 
-		workerWg.Wait()
+// Same as trainBatch, but each worker evaluates its part of the batch at once, see BatchLayer
+func (nt *NetworkTrainer) trainBatchMatrices(n *Network, batch Dataset, weighted bool, optimizer Optimizer) (runningLoss float64) {
+	loss := optimizer.Loss()
+	sampleWeights := batch.sampleWeights(weighted)
+	runningLoss, lossGradients := batchLoss(n, batch, sampleWeights, loss)
+	nbWorkers := nt.nbWorkers()
+	chunkSize := (len(batch) + nbWorkers - 1) / nbWorkers
+	runningLosses := make([]float64, nbWorkers)
+	var workerWg sync.WaitGroup
 
-		close(resultChannel)
-		for res := range resultChannel {
-			globalRunningLoss += res.runningLoss
+	for iWorker := 0; iWorker*chunkSize < len(batch); iWorker++ {
+		upperBound := (iWorker + 1) * chunkSize
+		if upperBound > len(batch) {
+			upperBound = len(batch)
 		}
+		start := iWorker * chunkSize
+		chunk := batch[start:upperBound]
+		workerRunningLoss := &runningLosses[iWorker]
+
+		workerWg.Add(1)
+		go func() {
+			defer workerWg.Done()
+			optimizer.RunWorker(func(worker *OptimizerWorker) {
+				bld := NewBatchLearnData(n)
+				inputs, actual := chunk.Matrices()
+
+				// --- Evaluation
+				bld.Predicted = n.EvaluateBatchWithLearnData(inputs, &bld)
+				bld.Actual = actual
+				if sampleWeights != nil {
+					bld.Weights = sampleWeights[start:upperBound]
+				}
+				if lossGradients == nil {
+					for i := range chunk {
+						*workerRunningLoss += weightedLoss(loss, bld.Predicted.RawRowView(i), actual.RawRowView(i), weightAt(bld.Weights, i))
+					}
+				} else {
+					_, cols := lossGradients.Dims()
+					bld.LossGradient = lossGradients.Slice(start, upperBound, 0, cols).(*mat.Dense)
+				}
 
-		optimizer.Step()
+				// --- Back-propagation
+				worker.BackpropagateBatch(&bld)
+			})
+		}()
 	}
 
-	globalRunningLoss /= float64(loader.batchSize)
+	workerWg.Wait()
+	runningLoss += utils.Sum(runningLosses) + float64(len(batch))*optimizer.RegularizationLoss()
+
+	optimizer.Step()
 	return
 }
+
+// For a BatchLoss, evaluates the whole batch before it is split between the workers, and returns the sum of the
+// weighted losses of the data points with the derivative of the loss w.r.t. the predicted values of each of them.
+// Returns 0 and nil for the other losses, computed by the workers.
+func batchLoss(n *Network, batch Dataset, sampleWeights []float64, loss Loss) (float64, *mat.Dense) {
+	bl, ok := loss.(BatchLoss)
+	if !ok || len(batch) == 0 {
+		return 0, nil
+	}
+	inputs, actual := batch.Matrices()
+	predicted := n.EvaluateBatch(inputs)
+	return sumBatchLoss(bl, predicted, actual, sampleWeights), bl.GradientBatch(predicted, actual)
+}
+
+type FitOptions struct {
+	// Number of epochs to run. If 0, runs until a callback stops the training.
+	Epochs int
+	// Optional, evaluated at the end of each epoch, the results being logged with a "val_" prefix
+	Validation Dataset
+	// Computed on the validation data, in addition to the loss
+	Metrics   []Metric
+	Callbacks []Callback
+}
+
+// Trains the network for several epochs, see FitOptions.
+// The logs of each epoch are "loss" (average loss on the training data), "learn_rate", and "val_loss" and
+// "val_<metric>" if there is validation data. Stops at the first epoch the loader fails (see DataLoader.Err) or yields
+// no data point.
+func (nt *NetworkTrainer) Fit(n *Network, loader *DataLoader, optimizer Optimizer, options FitOptions) (*History, error) {
+	ctx := &FitContext{
+		Network:   n,
+		Optimizer: optimizer,
+		History:   &History{},
+	}
+	for ; options.Epochs <= 0 || ctx.Epoch < options.Epochs; ctx.Epoch++ {
+		runningLoss := float64(0)
+		nbDataPoints := 0
+		it := loader.Iter()
+		for iBatch := 0; ; iBatch++ {
+			batch, ok := it.Next()
+			if !ok {
+				break
+			}
+			batchLoss := nt.trainBatch(n, batch, loader.weighted, optimizer)
+			runningLoss += batchLoss
+			nbDataPoints += len(batch)
+			for _, c := range options.Callbacks {
+				c.OnBatchEnd(ctx, iBatch, batchLoss/float64(len(batch)))
+			}
+		}
+		if err := loader.Err(); err != nil {
+			return ctx.History, fmt.Errorf("cannot train epoch %d: %w", ctx.Epoch, err)
+		}
+		if nbDataPoints == 0 {
+			// E.g. with DropLast and a batch size larger than the dataset
+			return ctx.History, fmt.Errorf("cannot train epoch %d: no data points", ctx.Epoch)
+		}
+
+		logs := EpochLogs{"loss": runningLoss / float64(nbDataPoints)}
+		if len(options.Validation) > 0 {
+			for name, value := range n.EvaluateMetrics(optimizer.Loss(), options.Metrics, options.Validation) {
+				logs["val_"+name] = value
+			}
+		}
+		logs["learn_rate"] = optimizer.LearnRate()
+		ctx.History.Epochs = append(ctx.History.Epochs, logs)
+		optimizer.EndEpoch(logs)
+
+		for _, c := range options.Callbacks {
+			c.OnEpochEnd(ctx, logs)
+		}
+		if ctx.StopTraining {
+			break
+		}
+	}
+	for _, c := range options.Callbacks {
+		c.OnTrainEnd(ctx)
+	}
+	return ctx.History, nil
+}
+
+// Logs of an epoch, indexed by metric name
+type EpochLogs map[string]float64
+
+type History struct {
+	Epochs []EpochLogs
+}
+
+// Returns the values of a metric for each epoch
+func (h *History) Metric(name string) []float64 {
+	return utils.InitSlice(len(h.Epochs), func(i int) float64 { return h.Epochs[i][name] })
+}
+
+// State of the training, passed to the callbacks
+type FitContext struct {
+	Network   *Network
+	Optimizer Optimizer
+	// Starts at 0
+	Epoch   int
+	History *History
+	// Set by a callback to stop the training at the end of the current epoch
+	StopTraining bool
+}
@@ -0,0 +1,162 @@
+package goflare
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/jjunac/goflare/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrainBatchedMatchesUnbatched(t *testing.T) {
+	assert := assert.New(t)
+	rng := rand.New(rand.NewSource(1337))
+	data := utils.InitSlice(20, func(i int) DataPoint {
+		class := rng.Intn(3)
+		return DataPoint{
+			Inputs:  utils.InitSlice(4, func(i int) float64 { return rng.Float64() }),
+			Outputs: utils.InitSlice(3, func(i int) float64 { return map[bool]float64{true: 1}[i == class] }),
+		}
+	})
+
+	for _, loss := range []LossFunc{MSELoss, CrossEntropyLoss} {
+		t.Run(loss.Name, func(t *testing.T) {
+			batched := NewNetwork([]Layer{
+				NewDenseLayer(4, 5, ReLU, WithRand(rng)),
+				NewDenseLayer(5, 3, Softmax, WithRand(rng)),
+			})
+			unbatched := CopyNetwork(&batched)
+			batchedLoss := (&NetworkTrainer{NbWorkers: 3}).Train(&batched, NewDataLoader(data, 8, false), NewSGD(&batched, loss, 0.1, 0.5))
+			unbatchedLoss := (&NetworkTrainer{NbWorkers: 3, Unbatched: true}).Train(&unbatched, NewDataLoader(data, 8, false), NewSGD(&unbatched, loss, 0.1, 0.5))
+
+			assert.InDelta(unbatchedLoss, batchedLoss, 1e-9)
+			for i := range batched.Layers {
+				params, expected := batched.Layers[i].Parameters(), unbatched.Layers[i].Parameters()
+				for j := range params {
+					assert.InDeltaSlice(expected[j], params[j], 1e-9)
+				}
+			}
+			inputs, _ := Dataset(data).Matrices()
+			outputs := batched.EvaluateBatch(inputs)
+			for i := range data {
+				assert.InDeltaSlice(batched.Evaluate(data[i].Inputs), outputs.RawRowView(i), 1e-9)
+			}
+		})
+	}
+}
+
+func TestTrainVectorLoss(t *testing.T) {
+	assert := assert.New(t)
+	rng := rand.New(rand.NewSource(7))
+	data := utils.InitSlice(12, func(i int) DataPoint {
+		return DataPoint{
+			Inputs:  utils.InitSlice(3, func(i int) float64 { return rng.Float64() }),
+			Outputs: utils.InitSlice(3, func(j int) float64 { return map[bool]float64{true: 1}[j == i%3] }),
+		}
+	})
+	// Softmax + CrossEntropyLoss learns the same as Linear + SoftmaxCrossEntropyFromLogitsLoss
+	softmax := NewNetwork([]Layer{NewDenseLayer(3, 3, Softmax, WithRand(rng))})
+	for _, unbatched := range []bool{false, true} {
+		logits := NewNetwork([]Layer{NewDenseLayer(3, 3, Linear)})
+		copy(logits.Layers[0].Parameters()[0], softmax.Layers[0].Parameters()[0])
+		copy(logits.Layers[0].Parameters()[1], softmax.Layers[0].Parameters()[1])
+		expected := CopyNetwork(&softmax)
+
+		trainer := &NetworkTrainer{NbWorkers: 2, Unbatched: unbatched}
+		expectedLoss := trainer.Train(&expected, NewDataLoader(data, 4, false), NewSGD(&expected, CrossEntropyLoss, 0.5, 0))
+		logitsLoss := trainer.Train(&logits, NewDataLoader(data, 4, false), NewSGD(&logits, SoftmaxCrossEntropyFromLogitsLoss, 0.5, 0))
+		assert.InDelta(expectedLoss, logitsLoss, 1e-9)
+		for j, param := range logits.Layers[0].Parameters() {
+			assert.InDeltaSlice(expected.Layers[0].Parameters()[j], param, 1e-9)
+		}
+		assert.InDelta(expected.AvgLoss(CrossEntropyLoss, data), logits.AvgLoss(SoftmaxCrossEntropyFromLogitsLoss, data), 1e-9)
+	}
+}
+
+func TestTrainBatchLoss(t *testing.T) {
+	assert := assert.New(t)
+	rng := rand.New(rand.NewSource(11))
+	data := utils.InitSlice(10, func(i int) DataPoint {
+		return DataPoint{
+			Inputs:  utils.InitSlice(3, func(i int) float64 { return rng.Float64() }),
+			Outputs: []float64{float64(i % 2)},
+		}
+	})
+	initial := NewNetwork([]Layer{NewDenseLayer(3, 4, Tanh, WithRand(rng)), NewDenseLayer(4, 2, Linear, WithRand(rng))})
+	loss := NewContrastiveLoss(1)
+
+	// The loss compares the data points of the whole batch, however it is split between the workers
+	var expected Network
+	var expectedLoss float64
+	for i, trainer := range []NetworkTrainer{{NbWorkers: 1}, {NbWorkers: 3}, {NbWorkers: 1, Unbatched: true}, {NbWorkers: 4, Unbatched: true}} {
+		n := CopyNetwork(&initial)
+		before := n.AvgLoss(loss, data)
+		trainLoss := trainer.Train(&n, NewDataLoader(data, len(data), false), NewSGD(&n, loss, 0.1, 0))
+		assert.InDelta(before, trainLoss, 1e-9)
+		if i == 0 {
+			expected, expectedLoss = n, trainLoss
+			assert.Less(n.AvgLoss(loss, data), before)
+			assert.InDelta(n.AvgLoss(loss, data), n.EvaluateMetrics(loss, nil, data)["loss"], 1e-9)
+			continue
+		}
+		assert.InDelta(expectedLoss, trainLoss, 1e-9)
+		for iLayer := range n.Layers {
+			for j, param := range n.Layers[iLayer].Parameters() {
+				assert.InDeltaSlice(expected.Layers[iLayer].Parameters()[j], param, 1e-9)
+			}
+		}
+	}
+}
+
+func TestTrainWeights(t *testing.T) {
+	assert := assert.New(t)
+	rng := rand.New(rand.NewSource(42))
+	data := Dataset{
+		{Inputs: []float64{0, 1}, Outputs: []float64{1, 0}},
+		{Inputs: []float64{1, 0}, Outputs: []float64{0, 1}},
+		{Inputs: []float64{1, 1}, Outputs: []float64{1, 0}},
+	}
+	// A data point of weight 2 counts as much as the same data point twice
+	duplicated := append(Dataset{data[1]}, data...)
+	weighted := Dataset(utils.CopySlice(data))
+	for i := range weighted {
+		weighted[i].Weight = 1
+	}
+	weighted[1].Weight = 2
+	// A data point of weight 0 is ignored
+	masked := append(Dataset{{Inputs: []float64{0, 0}, Outputs: []float64{0, 1}, Weight: 0}}, weighted...)
+	assert.Equal([]float64{4.0 / 6, 2}, BalancedClassWeights(append(data, data[0])))
+
+	for _, unbatched := range []bool{false, true} {
+		for _, loss := range []LossFunc{MSELoss, CrossEntropyLoss} {
+			network := NewNetwork([]Layer{NewDenseLayer(2, 3, ReLU, WithRand(rng)), NewDenseLayer(3, 2, Softmax, WithRand(rng))})
+			train := func(loss LossFunc, data Dataset, options ...DataLoaderOption) (Network, float64) {
+				n := CopyNetwork(&network)
+				trainer := NetworkTrainer{NbWorkers: 2, Unbatched: unbatched}
+				// Train divides the total loss by the batch size
+				runningLoss := trainer.Train(&n, NewDataLoader(data, len(data), false, options...), NewSGD(&n, loss, 0.1, 0))
+				return n, runningLoss * float64(len(data))
+			}
+			expected, expectedLoss := train(loss, duplicated)
+			for _, tt := range []struct {
+				name    string
+				loss    LossFunc
+				data    Dataset
+				options []DataLoaderOption
+			}{
+				{"sample weights", loss, weighted, []DataLoaderOption{WithSampleWeights()}},
+				{"masked", loss, masked, []DataLoaderOption{WithSampleWeights()}},
+				// The weights of the data points, all 0 here, are ignored without WithSampleWeights
+				{"class weights", loss.WithClassWeights([]float64{1, 2}), data, nil},
+			} {
+				actual, actualLoss := train(tt.loss, tt.data, tt.options...)
+				assert.InDelta(expectedLoss, actualLoss, 1e-9, "%s, %s, unbatched: %v", tt.name, loss.Name, unbatched)
+				for i := range actual.Layers {
+					for j, param := range actual.Layers[i].Parameters() {
+						assert.InDeltaSlice(expected.Layers[i].Parameters()[j], param, 1e-9)
+					}
+				}
+			}
+		}
+	}
+}
@@ -1,84 +1,169 @@
 package goflare
 
 import (
+	"fmt"
 	"sync"
 
 	"github.com/jjunac/goflare/utils"
 
 	"github.com/sirupsen/logrus"
+	"gonum.org/v1/gonum/mat"
 )
 
-type Optimizer struct {
+// An Optimizer accumulates the gradients computed by its workers, and uses them to update the network parameters.
+type Optimizer interface {
+	// Runs f with a new worker, then integrates the gradients it computed. Safe to call in parallel.
+	RunWorker(f func(worker *OptimizerWorker))
+	// Applies the accumulated gradients to the network, then resets them.
+	// NOTE: This is *NOT* thread safe
+	Step()
+	// Reset the internal gradients, typically used at the beginning of a batch
+	ZeroGrad()
+	Loss() Loss
+	LearnRate() float64
+	// Sets both the current and the initial learning rate (the one the scheduler starts from)
+	SetLearnRate(learnRate float64)
+	// Adjusts the learning rate after each step or each epoch, depending on unit. Nil removes the scheduler.
+	SetScheduler(scheduler Scheduler, unit ScheduleUnit)
+	// Regularizes the weights of all the layers, replacing their previous regularization
+	SetRegularization(r Regularization)
+	// Regularizes the weights of a layer, replacing its previous regularization
+	SetLayerRegularization(iLayer int, r Regularization)
+	// Returns the regularization term of the loss of each data point, for the current parameters
+	RegularizationLoss() float64
+	// Clips the gradients before each update, replacing the previous clipping
+	SetGradientClipping(c GradientClipping)
+	// Returns the L2 norm of the mean gradient of the last step across all the layers, before its clipping
+	GradientNorm() float64
+	// Notifies the end of an epoch, with its logs, to the epoch schedulers. Called by NetworkTrainer.Fit.
+	EndEpoch(logs EpochLogs)
+	// Returns a copy of the internal state (moments, number of steps...), to be saved with the network
+	State() OptimizerState
+	// Restores a state returned by State, typically to resume a training
+	LoadState(state OptimizerState) error
+}
+
+// Internal state of an optimizer. Buffers are indexed by layer, then by parameter (see Layer.Parameters).
+type OptimizerState struct {
+	Name      string
+	LearnRate float64
+	// Learning rate the scheduler computes from, see SetLearnRate and Scheduler
+	InitialLearnRate float64
+	Steps            int
+	Epochs           int
+	Buffers          map[string][][][]float64
+}
+
+// Common part of the optimizers: the gradient accumulation
+type optimizerBase struct {
 	nn        *Network
-	loss      LossFunc
+	loss      Loss
 	d         OptimizerData
 	dLock     sync.Mutex
 	learnRate float64
-	momentum  float64
+	steps     int
+
+	initialLearnRate float64
+	epochs           int
+	scheduler        Scheduler
+	scheduleUnit     ScheduleUnit
+	regularizations  []Regularization
+	clipping         GradientClipping
+	gradientNorm     float64
 }
 
 type OptimizerWorker struct {
 	nn   Network
-	loss LossFunc
+	loss Loss
 	d    OptimizerData
 }
 
 type OptimizerData struct {
 	layerD []OptimizerLayerData
+	// Number of data points whose gradients are accumulated
+	nbDataPoints int
 }
 
+// Gradients of each parameter of a layer, shaped like Layer.Parameters()
 type OptimizerLayerData struct {
-	GradientW [][]float64
-	VelocityW [][]float64
-	GradientB []float64
-	VelocityB []float64
+	Gradients [][]float64
 }
 
-func NewOptimizer(nn *Network, loss LossFunc, learnRate float64, momentum float64) *Optimizer {
-	o := &Optimizer{
+func newOptimizerBase(nn *Network, loss Loss, learnRate float64) optimizerBase {
+	return optimizerBase{
 		nn:        nn,
 		loss:      loss,
 		d:         NewOptimizerData(nn),
 		learnRate: learnRate,
-		momentum:  momentum,
+
+		initialLearnRate: learnRate,
+		regularizations:  make([]Regularization, len(nn.Layers)),
 	}
-	return o
 }
 
 func NewOptimizerData(nn *Network) OptimizerData {
 	return OptimizerData{
 		layerD: utils.InitSlice(len(nn.Layers), func(i int) OptimizerLayerData {
-			l := &nn.Layers[i]
 			return OptimizerLayerData{
-				GradientW: utils.MakeSlice2d[float64](len(l.Weights), len(l.Weights[0])),
-				VelocityW: utils.MakeSlice2d[float64](len(l.Weights), len(l.Weights[0])),
-				GradientB: make([]float64, len(l.Biases)),
-				VelocityB: make([]float64, len(l.Biases)),
+				Gradients: NewParametersLike(nn.Layers[i]),
 			}
 		}),
 	}
 }
 
+// Allocates a zero-ed buffer per parameter of the network, indexed by layer then by parameter.
+// Used by the optimizers to store their moments.
+func newParametersBuffers(nn *Network) [][][]float64 {
+	return utils.InitSlice(len(nn.Layers), func(i int) [][]float64 { return NewParametersLike(nn.Layers[i]) })
+}
+
 func (self *OptimizerData) Integrate(other *OptimizerData) {
+	self.nbDataPoints += other.nbDataPoints
 	for i := range other.layerD {
 		selfLayerD := self.layerD[i]
 		otherLayerD := other.layerD[i]
-		// Weight gradients + velocity
-		for j := range otherLayerD.GradientW {
-			for k := range otherLayerD.GradientW[j] {
-				selfLayerD.GradientW[j][k] += otherLayerD.GradientW[j][k]
-				selfLayerD.VelocityW[j][k] += otherLayerD.VelocityW[j][k]
+		for j := range otherLayerD.Gradients {
+			for k := range otherLayerD.Gradients[j] {
+				selfLayerD.Gradients[j][k] += otherLayerD.Gradients[j][k]
 			}
 		}
-		// Bias gradients + velocity
-		for j := range otherLayerD.GradientB {
-			selfLayerD.GradientB[j] += otherLayerD.GradientB[j]
-			selfLayerD.VelocityB[j] += otherLayerD.VelocityB[j]
+	}
+}
+
+func (o *optimizerBase) Loss() Loss {
+	return o.loss
+}
+
+func (o *optimizerBase) LearnRate() float64 {
+	return o.learnRate
+}
+
+func (o *optimizerBase) SetLearnRate(learnRate float64) {
+	o.learnRate = learnRate
+	o.initialLearnRate = learnRate
+}
+
+func (o *optimizerBase) SetScheduler(scheduler Scheduler, unit ScheduleUnit) {
+	o.scheduler = scheduler
+	o.scheduleUnit = unit
+	if scheduler != nil {
+		// The first step or epoch can already have a specific learning rate, e.g. with a warmup
+		t := o.steps
+		if unit == PerEpoch {
+			t = o.epochs
 		}
+		o.learnRate = scheduler.LearnRate(o.initialLearnRate, o.learnRate, t, nil)
 	}
 }
 
-func (o *Optimizer) RunWorker(f func(worker *OptimizerWorker)) {
+func (o *optimizerBase) EndEpoch(logs EpochLogs) {
+	o.epochs++
+	if o.scheduler != nil && o.scheduleUnit == PerEpoch {
+		o.learnRate = o.scheduler.LearnRate(o.initialLearnRate, o.learnRate, o.epochs, logs)
+	}
+}
+
+func (o *optimizerBase) RunWorker(f func(worker *OptimizerWorker)) {
 	// Creating the worker
 	w := OptimizerWorker{
 		// TODO: Investigate if we really gain perf by copying the network
@@ -94,100 +179,190 @@ func (o *Optimizer) RunWorker(f func(worker *OptimizerWorker)) {
 	o.dLock.Unlock()
 }
 
-// Backpropgate the errors using the SGD algorithm and stores the gradients internally.
-// The network parameters are not updated by this methods, see Optimizer.Step.
-func (w *OptimizerWorker) Backpropagate(nld *NetworkLearnData) {
-	// --- Last layer handling
-	{
-		l := &w.nn.Layers[len(w.nn.Layers)-1]
-		lld := &nld.LayerData[len(nld.LayerData)-1]
-		lld.LossDerivative = make([]float64, len(nld.Predicted))
-		for i := range lld.LossDerivative {
-			lld.LossDerivative[i] = w.loss.FPrime(nld.Predicted[i], nld.Actual[i])
-			logrus.Debugln(lld.LossDerivative[i])
-			lld.LossDerivative[i] *= l.Activation.FPrime(lld.WeightedValues[i])
+// Calls update for each parameter of the network with its gradient, then resets the gradients.
+// iLayer and iParam can be used to index the buffers allocated by newParametersBuffers.
+// The gradients are clipped first (see GradientClipping), and the regularization is applied around the update (see
+// Regularization).
+func (o *optimizerBase) step(update func(iLayer int, iParam int, param []float64, gradient []float64)) {
+	o.clipGradients()
+	for iLayer := range o.nn.Layers {
+		params := o.nn.Layers[iLayer].Parameters()
+		r, l := &o.regularizations[iLayer], o.regularizedLayer(iLayer)
+		if l != nil {
+			r.addGradient(params[0], o.d.layerD[iLayer].Gradients[0], o.d.nbDataPoints)
+			r.decay(params[0], o.learnRate)
 		}
+		for iParam := range params {
+			update(iLayer, iParam, params[iParam], o.d.layerD[iLayer].Gradients[iParam])
+		}
+		if l != nil {
+			r.constrain(l.WeightsMatrix())
+		}
+	}
+	o.steps++
+	o.ZeroGrad()
+	if o.scheduler != nil && o.scheduleUnit == PerStep {
+		o.learnRate = o.scheduler.LearnRate(o.initialLearnRate, o.learnRate, o.steps, nil)
+	}
+}
+
+func (o *optimizerBase) state(name string, buffers map[string][][][]float64) OptimizerState {
+	state := OptimizerState{
+		Name:             name,
+		LearnRate:        o.learnRate,
+		InitialLearnRate: o.initialLearnRate,
+		Steps:            o.steps,
+		Epochs:           o.epochs,
+		Buffers:          make(map[string][][][]float64, len(buffers)),
+	}
+	for k, buffer := range buffers {
+		state.Buffers[k] = utils.InitSlice(len(buffer), func(i int) [][]float64 { return utils.Copy2dSlice(buffer[i]) })
+	}
+	return state
+}
 
-		logrus.Debugf("Actual   : %+v", nld.Actual)
-		logrus.Debugf("Predicted: %+v", nld.Predicted)
-		logrus.Debugf("Loss'    : %+v", lld.LossDerivative)
-		logrus.Debugf("WeigthIn : %+v", lld.WeightedValues)
-		logrus.Debugf("Inputs   : %+v", lld.Inputs)
-	}
-
-	// --- Propagation from n-1 to 0
-	for iLayer := len(w.nn.Layers) - 2; iLayer >= 0; iLayer-- {
-		l := &w.nn.Layers[iLayer]
-		lld := &nld.LayerData[iLayer]
-		lld.LossDerivative = make([]float64, l.NodesOut)
-		prev := &w.nn.Layers[iLayer+1]
-		prevLld := &nld.LayerData[iLayer+1]
-
-		for node := 0; node < l.NodesOut; node++ {
-			valueError := float64(0)
-			for i := range prevLld.LossDerivative {
-				valueError += prevLld.LossDerivative[i] * prev.Weights[node][i]
+// Copies the buffers of the state into the given ones, after checking that they have the same shape
+func (o *optimizerBase) loadState(state OptimizerState, name string, buffers map[string][][][]float64) error {
+	if state.Name != name {
+		return fmt.Errorf("cannot load a %s state into a %s optimizer", state.Name, name)
+	}
+	for k, buffer := range buffers {
+		loaded, ok := state.Buffers[k]
+		if !ok {
+			return fmt.Errorf("missing buffer %s in %s state", k, name)
+		}
+		if len(loaded) != len(buffer) {
+			return fmt.Errorf("buffer %s has %d layers, expected %d", k, len(loaded), len(buffer))
+		}
+		for iLayer := range buffer {
+			if len(loaded[iLayer]) != len(buffer[iLayer]) {
+				return fmt.Errorf("buffer %s has %d parameters on layer %d, expected %d", k, len(loaded[iLayer]), iLayer, len(buffer[iLayer]))
+			}
+			for iParam := range buffer[iLayer] {
+				if len(loaded[iLayer][iParam]) != len(buffer[iLayer][iParam]) {
+					return fmt.Errorf("buffer %s has a wrong size on layer %d, parameter %d", k, iLayer, iParam)
+				}
 			}
-			valueError *= l.Activation.FPrime(lld.WeightedValues[node])
-			lld.LossDerivative[node] = valueError
 		}
 	}
-
-	// --- Update gradients
-	for iLayer := range w.nn.Layers {
-		l := &w.nn.Layers[iLayer]
-		lld := &nld.LayerData[iLayer]
-		wld := &w.d.layerD[iLayer]
-		for nodeOut := 0; nodeOut < l.NodesOut; nodeOut++ {
-			lossDerivative := lld.LossDerivative[nodeOut]
-			// Update biases
-			wld.GradientB[nodeOut] += lossDerivative
-			// Update weights
-			for nodeIn := 0; nodeIn < l.NodesIn; nodeIn++ {
-				wld.GradientW[nodeIn][nodeOut] += lossDerivative * lld.Inputs[nodeIn]
+	for k, buffer := range buffers {
+		for iLayer := range buffer {
+			for iParam := range buffer[iLayer] {
+				copy(buffer[iLayer][iParam], state.Buffers[k][iLayer][iParam])
 			}
 		}
 	}
+	o.learnRate = state.LearnRate
+	o.initialLearnRate = state.InitialLearnRate
+	o.steps = state.Steps
+	o.epochs = state.Epochs
+	return nil
 }
 
-// Applies and reset the gradient to the network.
-// NOTE: This is *NOT* thread safe
-func (o *Optimizer) Step() {
-	for iLayer := range o.nn.Layers {
-		l := &o.nn.Layers[iLayer]
-		ld := o.d.layerD[iLayer]
-		weightDecay := float64(1)
-		for nodeOut := 0; nodeOut < l.NodesOut; nodeOut++ {
-			// Biases
-			biasVelocity := ld.VelocityB[nodeOut]*o.momentum - ld.GradientB[nodeOut]*o.learnRate
-			ld.VelocityB[nodeOut] = biasVelocity
-			l.Biases[nodeOut] += biasVelocity
-			ld.GradientB[nodeOut] = 0
-			// Weights
-			for nodeIn := 0; nodeIn < l.NodesIn; nodeIn++ {
-				weight := l.Weights[nodeIn][nodeOut]
-				weightVelocity := ld.VelocityW[nodeIn][nodeOut]*o.momentum - ld.GradientW[nodeIn][nodeOut]*o.learnRate
-				ld.VelocityW[nodeIn][nodeOut] = weightVelocity
-				l.Weights[nodeIn][nodeOut] = weight*weightDecay + weightVelocity
-				ld.GradientW[nodeIn][nodeOut] = 0
+func (o *optimizerBase) ZeroGrad() {
+	o.d.nbDataPoints = 0
+	for i := range o.d.layerD {
+		ld := &o.d.layerD[i]
+		for j := range ld.Gradients {
+			for k := range ld.Gradients[j] {
+				ld.Gradients[j][k] = 0
 			}
 		}
 	}
+}
 
-	o.ZeroGrad()
+// Backpropgate the errors and stores the gradients internally.
+// The network parameters are not updated by this methods, see Optimizer.Step.
+func (w *OptimizerWorker) Backpropagate(nld *NetworkLearnData) {
+	w.d.nbDataPoints++
+	iLayer := len(w.nn.Layers) - 1
+	var gradient []float64
+
+	// --- Last layer handling, combining the loss and activation derivatives when possible
+	if nld.LossGradient != nil {
+		gradient = utils.CopySlice(nld.LossGradient)
+		scale(gradient, lossWeight(w.loss, nld.Actual, nld.Weight))
+	} else if last, ok := w.nn.Layers[iLayer].(ActivatedLayer); ok {
+		if fusedPrime := fusedGradient(w.loss, last.OutputActivation().Name); fusedPrime != nil {
+			weightedGradient := fusedPrime(nld.Predicted, nld.Actual)
+			scale(weightedGradient, lossWeight(w.loss, nld.Actual, nld.Weight))
+			gradient = last.BackwardWeighted(weightedGradient, &nld.LayerData[iLayer], w.d.layerD[iLayer].Gradients)
+			iLayer--
+		}
+	}
+	if gradient == nil {
+		gradient = w.loss.Gradient(nld.Predicted, nld.Actual)
+		scale(gradient, lossWeight(w.loss, nld.Actual, nld.Weight))
+	}
+
+	logrus.Debugf("Actual   : %+v", nld.Actual)
+	logrus.Debugf("Predicted: %+v", nld.Predicted)
+	logrus.Debugf("Loss'    : %+v", gradient)
+
+	// --- Propagation down to 0, each layer accumulating its own gradients
+	for ; iLayer >= 0; iLayer-- {
+		gradient = w.nn.Layers[iLayer].Backward(gradient, &nld.LayerData[iLayer], w.d.layerD[iLayer].Gradients)
+	}
 }
 
-// Reset the internal gradients, typically used at the beginning of a batch
-func (o *Optimizer) ZeroGrad() {
-	for i := range o.d.layerD {
-		ld := &o.d.layerD[i]
-		for j := range ld.GradientW {
-			for k := range ld.GradientW[j] {
-				ld.GradientW[j][k] = 0
-			}
+// Batch counterpart of Backpropagate.
+// NOTE: All the layers must implement BatchLayer, see Network.SupportsBatches
+func (w *OptimizerWorker) BackpropagateBatch(bld *BatchLearnData) {
+	rows, _ := bld.Predicted.Dims()
+	w.d.nbDataPoints += rows
+	iLayer := len(w.nn.Layers) - 1
+	var gradient *mat.Dense
+
+	// --- Last layer handling, combining the loss and activation derivatives when possible
+	if bld.LossGradient != nil {
+		gradient = mat.DenseCopyOf(bld.LossGradient)
+		w.scaleRows(gradient, bld)
+	} else if last, ok := w.nn.Layers[iLayer].(BatchActivatedLayer); ok {
+		if fusedPrime := fusedGradient(w.loss, last.OutputActivation().Name); fusedPrime != nil {
+			weightedGradient := mapRows(bld.Predicted, bld.Actual, fusedPrime)
+			w.scaleRows(weightedGradient, bld)
+			gradient = last.BackwardWeightedBatch(weightedGradient, &bld.LayerData[iLayer], w.d.layerD[iLayer].Gradients)
+			iLayer--
 		}
-		for j := range ld.GradientB {
-			ld.GradientB[j] = 0
+	}
+	if gradient == nil {
+		gradient = mapRows(bld.Predicted, bld.Actual, w.loss.Gradient)
+		w.scaleRows(gradient, bld)
+	}
+
+	// --- Propagation down to 0, each layer accumulating its own gradients
+	for ; iLayer >= 0; iLayer-- {
+		gradient = w.nn.Layers[iLayer].(BatchLayer).BackwardBatch(gradient, &bld.LayerData[iLayer], w.d.layerD[iLayer].Gradients)
+	}
+}
+
+// Multiplies each row of the gradient by the weight of its data point
+func (w *OptimizerWorker) scaleRows(gradient *mat.Dense, bld *BatchLearnData) {
+	rows, _ := gradient.Dims()
+	for i := 0; i < rows; i++ {
+		scale(gradient.RawRowView(i), lossWeight(w.loss, bld.Actual.RawRowView(i), weightAt(bld.Weights, i)))
+	}
+}
+
+func scale(values []float64, factor float64) {
+	if factor == 1 {
+		return
+	}
+	for i := range values {
+		values[i] *= factor
+	}
+}
+
+// Applies f on each pair of rows of a and b, the results being the rows of the returned matrix
+func mapRows(a *mat.Dense, b *mat.Dense, f func(a []float64, b []float64) []float64) *mat.Dense {
+	rows, _ := a.Dims()
+	var res *mat.Dense
+	for i := 0; i < rows; i++ {
+		row := f(a.RawRowView(i), b.RawRowView(i))
+		if res == nil {
+			res = mat.NewDense(rows, len(row), nil)
 		}
+		res.SetRow(i, row)
 	}
+	return res
 }
@@ -0,0 +1,156 @@
+package goflare
+
+import "math"
+
+// Stochastic gradient descent, with momentum
+type SGD struct {
+	optimizerBase
+	momentum   float64
+	velocities [][][]float64
+}
+
+func NewSGD(nn *Network, loss Loss, learnRate float64, momentum float64) *SGD {
+	return &SGD{
+		optimizerBase: newOptimizerBase(nn, loss, learnRate),
+		momentum:      momentum,
+		velocities:    newParametersBuffers(nn),
+	}
+}
+
+func (o *SGD) Step() {
+	o.step(func(iLayer int, iParam int, param []float64, gradient []float64) {
+		velocity := o.velocities[iLayer][iParam]
+		for i := range param {
+			velocity[i] = velocity[i]*o.momentum - gradient[i]*o.learnRate
+			param[i] += velocity[i]
+		}
+	})
+}
+
+func (o *SGD) State() OptimizerState {
+	return o.state("SGD", map[string][][][]float64{"Velocities": o.velocities})
+}
+
+func (o *SGD) LoadState(state OptimizerState) error {
+	return o.loadState(state, "SGD", map[string][][][]float64{"Velocities": o.velocities})
+}
+
+// Adam (adaptive moment estimation), see https://arxiv.org/abs/1412.6980.
+// With a Regularization.WeightDecay, it is AdamW, see NewAdamW.
+type Adam struct {
+	optimizerBase
+	Beta1   float64
+	Beta2   float64
+	Epsilon float64
+	m       [][][]float64
+	v       [][][]float64
+}
+
+func NewAdam(nn *Network, loss Loss, learnRate float64) *Adam {
+	return &Adam{
+		optimizerBase: newOptimizerBase(nn, loss, learnRate),
+		Beta1:         0.9,
+		Beta2:         0.999,
+		Epsilon:       1e-8,
+		m:             newParametersBuffers(nn),
+		v:             newParametersBuffers(nn),
+	}
+}
+
+// Adam with decoupled weight decay, see https://arxiv.org/abs/1711.05101 and Regularization.WeightDecay
+func NewAdamW(nn *Network, loss Loss, learnRate float64, weightDecay float64) *Adam {
+	o := NewAdam(nn, loss, learnRate)
+	o.SetRegularization(Regularization{WeightDecay: weightDecay})
+	return o
+}
+
+func (o *Adam) Step() {
+	// Bias corrections, since the moments are initialized at 0
+	t := float64(o.steps + 1)
+	correction1 := 1 - math.Pow(o.Beta1, t)
+	correction2 := 1 - math.Pow(o.Beta2, t)
+	o.step(func(iLayer int, iParam int, param []float64, gradient []float64) {
+		m, v := o.m[iLayer][iParam], o.v[iLayer][iParam]
+		for i := range param {
+			m[i] = o.Beta1*m[i] + (1-o.Beta1)*gradient[i]
+			v[i] = o.Beta2*v[i] + (1-o.Beta2)*gradient[i]*gradient[i]
+			param[i] -= o.learnRate * (m[i] / correction1) / (math.Sqrt(v[i]/correction2) + o.Epsilon)
+		}
+	})
+}
+
+func (o *Adam) State() OptimizerState {
+	return o.state("Adam", map[string][][][]float64{"M": o.m, "V": o.v})
+}
+
+func (o *Adam) LoadState(state OptimizerState) error {
+	return o.loadState(state, "Adam", map[string][][][]float64{"M": o.m, "V": o.v})
+}
+
+// RMSProp, dividing the gradients by a moving average of their magnitude
+type RMSProp struct {
+	optimizerBase
+	Rho     float64
+	Epsilon float64
+	v       [][][]float64
+}
+
+func NewRMSProp(nn *Network, loss Loss, learnRate float64) *RMSProp {
+	return &RMSProp{
+		optimizerBase: newOptimizerBase(nn, loss, learnRate),
+		Rho:           0.9,
+		Epsilon:       1e-8,
+		v:             newParametersBuffers(nn),
+	}
+}
+
+func (o *RMSProp) Step() {
+	o.step(func(iLayer int, iParam int, param []float64, gradient []float64) {
+		v := o.v[iLayer][iParam]
+		for i := range param {
+			v[i] = o.Rho*v[i] + (1-o.Rho)*gradient[i]*gradient[i]
+			param[i] -= o.learnRate * gradient[i] / (math.Sqrt(v[i]) + o.Epsilon)
+		}
+	})
+}
+
+func (o *RMSProp) State() OptimizerState {
+	return o.state("RMSProp", map[string][][][]float64{"V": o.v})
+}
+
+func (o *RMSProp) LoadState(state OptimizerState) error {
+	return o.loadState(state, "RMSProp", map[string][][][]float64{"V": o.v})
+}
+
+// Adagrad, dividing the gradients by the square root of the sum of all the past squared gradients
+type Adagrad struct {
+	optimizerBase
+	Epsilon float64
+	sum     [][][]float64
+}
+
+func NewAdagrad(nn *Network, loss Loss, learnRate float64) *Adagrad {
+	return &Adagrad{
+		optimizerBase: newOptimizerBase(nn, loss, learnRate),
+		Epsilon:       1e-10,
+		sum:           newParametersBuffers(nn),
+	}
+}
+
+func (o *Adagrad) Step() {
+	o.step(func(iLayer int, iParam int, param []float64, gradient []float64) {
+		sum := o.sum[iLayer][iParam]
+		for i := range param {
+			sum[i] += gradient[i] * gradient[i]
+			param[i] -= o.learnRate * gradient[i] / (math.Sqrt(sum[i]) + o.Epsilon)
+		}
+	})
+}
+
+func (o *Adagrad) State() OptimizerState {
+	return o.state("Adagrad", map[string][][][]float64{"Sum": o.sum})
+}
+
+func (o *Adagrad) LoadState(state OptimizerState) error {
+	return o.loadState(state, "Adagrad", map[string][][][]float64{"Sum": o.sum})
+}
@@ -0,0 +1,44 @@
+package goflare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptimizersStep(t *testing.T) {
+	assert := assert.New(t)
+	// Two steps on a weight of 0.5 and a bias of -0.2, with a learning rate of 0.1, the weight and bias gradients being
+	// (0.4, -0.1) then (0.2, 0.3). The expected values are computed by hand from the update rules.
+	tests := []struct {
+		name     string
+		new      func(nn *Network) Optimizer
+		expected []float64
+	}{
+		// v = 0.9 * v - 0.1 * g; p += v
+		{"SGD", func(nn *Network) Optimizer { return NewSGD(nn, MSELoss, 0.1, 0.9) }, []float64{0.404, -0.211}},
+		// m = 0.9 * m + 0.1 * g; v = 0.999 * v + 0.001 * g²; p -= 0.1 * (m / (1 - 0.9^t)) / (sqrt(v / (1 - 0.999^t)) + 1e-8)
+		{"Adam", func(nn *Network) Optimizer { return NewAdam(nn, MSELoss, 0.1) }, []float64{0.30678204156711275, -0.14941899112006538}},
+		// Same as Adam, after the weight (but not the bias) is shrunk by p -= 0.1 * 0.5 * p at each step
+		{"AdamW", func(nn *Network) Optimizer { return NewAdamW(nn, MSELoss, 0.1, 0.5) }, []float64{0.26303204144211273, -0.14941899112006538}},
+		// v = 0.9 * v + 0.1 * g²; p -= 0.1 * g / (sqrt(v) + 1e-8)
+		{"RMSProp", func(nn *Network) Optimizer { return NewRMSProp(nn, MSELoss, 0.1) }, []float64{0.03633031369782733, -0.18528364825786686}},
+		// s += g²; p -= 0.1 * g / (sqrt(s) + 1e-10)
+		{"Adagrad", func(nn *Network) Optimizer { return NewAdagrad(nn, MSELoss, 0.1) }, []float64{0.3552786404850042, -0.19486832987505137}},
+	}
+	for _, tt := range tests {
+		layer := NewDenseLayer(1, 1, Linear)
+		layer.Weights[0], layer.Biases[0] = 0.5, -0.2
+		nn := NewNetwork([]Layer{layer})
+		o := tt.new(&nn)
+		for _, gradients := range [][]float64{{0.4, -0.1}, {0.2, 0.3}} {
+			o.RunWorker(func(worker *OptimizerWorker) {
+				worker.d.layerD[0].Gradients[0][0] = gradients[0]
+				worker.d.layerD[0].Gradients[1][0] = gradients[1]
+			})
+			o.Step()
+		}
+		assert.InDelta(tt.expected[0], layer.Weights[0], 1e-12, tt.name)
+		assert.InDelta(tt.expected[1], layer.Biases[0], 1e-12, tt.name)
+	}
+}
@@ -3,14 +3,35 @@ package goflare
 import (
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"strconv"
 
 	"github.com/jjunac/goflare/utils"
 )
 
+// A ColumnProcessor transforms the values of a column in two phases: it first observes all the values of the column
+// with Fit (e.g. to compute their mean), then transforms them with Transform. Once fitted, it can transform any
+// other value, e.g. from test or inference data.
+type ColumnProcessor interface {
+	Fit(value any) error
+	Transform(value any) (any, error)
+}
+
+// A stateless processor, transforming each value independently
 type ValueProcessor func(value any) (any, error)
-type PipelineProcessor func() ValueProcessor
+
+// A ValueProcessor doesn't need to observe the values
+func (vp ValueProcessor) Fit(value any) error {
+	return nil
+}
+
+func (vp ValueProcessor) Transform(value any) (any, error) {
+	return vp(value)
+}
+
+// Creates a new processor for each column it is added to
+type PipelineProcessor func() ColumnProcessor
 
 func TypedValueProcessor[T any](next func(value T) (any, error)) ValueProcessor {
 	return func(value any) (any, error) {
@@ -22,81 +43,426 @@ func TypedValueProcessor[T any](next func(value T) (any, error)) ValueProcessor
 	}
 }
 
+// Implemented by the processors handling the missing values themselves, e.g. the imputers.
+// The missing values (nil) are not passed to the other processors: they stay missing.
+type MissingValueHandler interface {
+	HandlesMissing() bool
+}
+
+func handlesValue(proc ColumnProcessor, value any) bool {
+	if value != nil {
+		return true
+	}
+	h, ok := proc.(MissingValueHandler)
+	return ok && h.HandlesMissing()
+}
+
 type DataPipelineOptions func(dp *DataPipeline)
 
 type DataPipeline struct {
-	targets    utils.Set[int]
-	ignored    []int
-	processors [][]ValueProcessor
+	targets utils.Set[int]
+	ignored utils.Set[int]
+	// Columns of the processed data, to reference them by name. Nil if unknown.
+	schema       Schema
+	ignoredNames []string
+	// String values considered missing, replaced by nil before processing
+	nullTokens      utils.Set[string]
+	dropMissingRows bool
+	// Added processors for each column, instantiated when fitting
+	factories  [][]PipelineProcessor
+	processors [][]ColumnProcessor
+	fitted     bool
 }
 
+// NOTE: panics if the columns are referenced by name in the options, see NewDataPipelineFromSchema
 func NewDataPipeline(nbCols int, targets []int, options ...DataPipelineOptions) *DataPipeline {
+	dp, err := newDataPipeline(nil, nbCols, targets, options)
+	if err != nil {
+		panic(err)
+	}
+	return dp
+}
+
+// Creates a pipeline for data with the given schema (see DataStream.Schema), whose columns can then be referenced by
+// name, e.g. with IgnoreNamedColumns or AddNamedColumnProcessor
+func NewDataPipelineFromSchema(schema Schema, targets []string, options ...DataPipelineOptions) (*DataPipeline, error) {
+	targetCols, err := schema.Indices(targets)
+	if err != nil {
+		return nil, err
+	}
+	return newDataPipeline(schema, len(schema), targetCols, options)
+}
+
+func newDataPipeline(schema Schema, nbCols int, targets []int, options []DataPipelineOptions) (*DataPipeline, error) {
 	dp := &DataPipeline{
-		utils.NewSetFromSlice(targets),
-		make([]int, 0),
-		utils.MakeSlice2d[ValueProcessor](nbCols, 0),
+		targets:    utils.NewSetFromSlice(targets),
+		ignored:    utils.NewSet[int](),
+		schema:     schema,
+		nullTokens: utils.NewSetFromSlice([]string{""}),
+		factories:  utils.MakeSlice2d[PipelineProcessor](nbCols, 0),
 	}
 	for i := range options {
 		options[i](dp)
 	}
-	return dp
+	if len(dp.ignoredNames) > 0 {
+		if dp.schema == nil {
+			return nil, errors.New("IgnoreNamedColumns requires a schema, see NewDataPipelineFromSchema")
+		}
+		ignored, err := dp.schema.Indices(dp.ignoredNames)
+		if err != nil {
+			return nil, err
+		}
+		for _, col := range ignored {
+			dp.ignored.Add(col)
+		}
+	}
+	return dp, nil
 }
 
+// The ignored columns are neither processed nor part of the Dataset built by DataStream.ToDataset
 func IgnoreColumns(ignored []int) DataPipelineOptions {
 	return func(dp *DataPipeline) {
-		dp.ignored = append(dp.ignored, ignored...)
+		for _, col := range ignored {
+			dp.ignored.Add(col)
+		}
+	}
+}
+
+// Same as IgnoreColumns, with the columns referenced by name. Only for NewDataPipelineFromSchema.
+func IgnoreNamedColumns(names ...string) DataPipelineOptions {
+	return func(dp *DataPipeline) {
+		dp.ignoredNames = append(dp.ignoredNames, names...)
+	}
+}
+
+// Sets the string values considered missing, only the empty string by default, e.g. NullTokens("", "NA", "?")
+func NullTokens(tokens ...string) DataPipelineOptions {
+	return func(dp *DataPipeline) {
+		dp.nullTokens = utils.NewSetFromSlice(tokens)
+	}
+}
+
+// Drops the rows having a missing value in a column that is not ignored, instead of processing them.
+// The values are checked before any processing, so the imputers never see a missing value.
+func DropMissingRows() DataPipelineOptions {
+	return func(dp *DataPipeline) {
+		dp.dropMissingRows = true
+	}
+}
+
+// Applies the previously added processors, fitting them on these rows first if they are not fitted yet.
+// The ignored columns are left untouched. Returns the processed rows, without the dropped ones (see DropMissingRows).
+// NOTE: this mutates the rows passed in param for performance reasons
+func (dp *DataPipeline) Apply(rows [][]any) ([][]any, error) {
+	if !dp.fitted {
+		return dp.FitApply(rows)
 	}
+	return dp.Transform(rows)
 }
 
-// Applies the previously added values processors.
+// Fits new processors on the rows, then applies them. Each processor of a column is fitted on the values
+// transformed by the previous ones.
 // NOTE: this mutates the rows passed in param for performance reasons
-func (dp *DataPipeline) Apply(rows [][]any) error {
+func (dp *DataPipeline) FitApply(rows [][]any) ([][]any, error) {
+	rows = dp.markMissing(rows)
+	dp.processors = utils.InitSlice(len(dp.factories), func(col int) []ColumnProcessor {
+		return utils.InitSlice(len(dp.factories[col]), func(i int) ColumnProcessor { return dp.factories[col][i]() })
+	})
 	var err error
-	for row := range rows {
-		for col := range rows[row] {
-			for proc := range dp.processors[col] {
-				rows[row][col], err = dp.processors[col][proc](rows[row][col])
+	for col := range dp.processors {
+		if dp.ignored.Contains(col) {
+			continue
+		}
+		for _, proc := range dp.processors[col] {
+			for row := range rows {
+				if !handlesValue(proc, rows[row][col]) {
+					continue
+				}
+				if err = proc.Fit(rows[row][col]); err != nil {
+					return nil, fmt.Errorf("cannot fit row %d col %d: %w", row, col, err)
+				}
+			}
+			for row := range rows {
+				if !handlesValue(proc, rows[row][col]) {
+					continue
+				}
+				rows[row][col], err = proc.Transform(rows[row][col])
 				if err != nil {
-					return fmt.Errorf("cannot process row %d col %d: %w", row, col, err)
+					return nil, fmt.Errorf("cannot process row %d col %d: %w", row, col, err)
 				}
 			}
 		}
 	}
+	dp.fitted = true
+	return rows, nil
+}
+
+// Applies the already fitted processors, see Apply and FitApply
+// NOTE: this mutates the rows passed in param for performance reasons
+func (dp *DataPipeline) Transform(rows [][]any) ([][]any, error) {
+	if !dp.fitted {
+		return nil, errors.New("the pipeline is not fitted")
+	}
+	rows = dp.markMissing(rows)
+	for row := range rows {
+		if err := dp.transformRow(rows[row], row); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+func (dp *DataPipeline) transformRow(row []any, rowIdx int) error {
+	var err error
+	for col := range row {
+		if dp.ignored.Contains(col) {
+			continue
+		}
+		for _, proc := range dp.processors[col] {
+			if !handlesValue(proc, row[col]) {
+				continue
+			}
+			row[col], err = proc.Transform(row[col])
+			if err != nil {
+				return fmt.Errorf("cannot process row %d col %d: %w", rowIdx, col, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Fits new processors on the rows read from the source, without keeping them in memory. Since each processor of a
+// column is fitted on the values transformed by the previous ones, the source is opened once per processor stage,
+// i.e. as many times as the max number of processors on a column. The iterators implementing io.Closer are closed.
+// NOTE: The processors may still keep some values to fit, e.g. all of them for PPImputer(ImputeMedian)
+func (dp *DataPipeline) FitIterator(open func() (RowIterator, error)) error {
+	dp.processors = utils.InitSlice(len(dp.factories), func(col int) []ColumnProcessor {
+		return utils.InitSlice(len(dp.factories[col]), func(i int) ColumnProcessor { return dp.factories[col][i]() })
+	})
+	stages := 0
+	for col := range dp.processors {
+		if len(dp.processors[col]) > stages {
+			stages = len(dp.processors[col])
+		}
+	}
+	for stage := 0; stage < stages; stage++ {
+		it, err := open()
+		if err != nil {
+			return fmt.Errorf("cannot open rows: %w", err)
+		}
+		err = dp.fitStage(it, stage)
+		closeRows(it)
+		if err != nil {
+			return err
+		}
+	}
+	dp.fitted = true
 	return nil
 }
 
-// Adds a ValueProcessor on specific columns
+// Fits the processors at index stage of each column, the previous ones being already fitted
+func (dp *DataPipeline) fitStage(it RowIterator, stage int) error {
+	for rowIdx := 0; ; rowIdx++ {
+		row, err := it.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read row %d: %w", rowIdx, err)
+		}
+		if dp.markMissingRow(row) && dp.dropMissingRows {
+			continue
+		}
+		for col := range row {
+			if dp.ignored.Contains(col) || stage >= len(dp.processors[col]) {
+				continue
+			}
+			for _, proc := range dp.processors[col][:stage] {
+				if !handlesValue(proc, row[col]) {
+					continue
+				}
+				if row[col], err = proc.Transform(row[col]); err != nil {
+					return fmt.Errorf("cannot process row %d col %d: %w", rowIdx, col, err)
+				}
+			}
+			proc := dp.processors[col][stage]
+			if !handlesValue(proc, row[col]) {
+				continue
+			}
+			if err = proc.Fit(row[col]); err != nil {
+				return fmt.Errorf("cannot fit row %d col %d: %w", rowIdx, col, err)
+			}
+		}
+	}
+}
+
+// Lazily applies the already fitted processors on the rows of the iterator, skipping the dropped ones
+func (dp *DataPipeline) TransformIterator(it RowIterator) RowIterator {
+	return &pipelineIterator{dp, it, 0}
+}
+
+type pipelineIterator struct {
+	dp     *DataPipeline
+	it     RowIterator
+	rowIdx int
+}
+
+func (pi *pipelineIterator) Next() ([]any, error) {
+	if !pi.dp.fitted {
+		return nil, errors.New("the pipeline is not fitted")
+	}
+	for {
+		row, err := pi.it.Next()
+		if err != nil {
+			if err != io.EOF {
+				err = fmt.Errorf("cannot read row %d: %w", pi.rowIdx, err)
+			}
+			return nil, err
+		}
+		rowIdx := pi.rowIdx
+		pi.rowIdx++
+		if pi.dp.markMissingRow(row) && pi.dp.dropMissingRows {
+			continue
+		}
+		if err = pi.dp.transformRow(row, rowIdx); err != nil {
+			return nil, err
+		}
+		return row, nil
+	}
+}
+
+// Transforms the rows of the iterator and converts them into data points, see DataStream.ToDataset.
+// Only the data points are kept in memory, not the raw rows. See NewStreamDataLoader to keep only a batch of them.
+func (dp *DataPipeline) ToDataset(it RowIterator) (Dataset, error) {
+	points := dp.dataPoints(it)
+	dataset := make(Dataset, 0)
+	for {
+		point, err := points.Next()
+		if err == io.EOF {
+			return dataset, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		dataset = append(dataset, point)
+	}
+}
+
+// Lazily transforms the rows of the iterator and converts them into data points
+func (dp *DataPipeline) dataPoints(it RowIterator) *dataPointIterator {
+	return &dataPointIterator{dp: dp, it: dp.TransformIterator(it)}
+}
+
+type dataPointIterator struct {
+	dp *DataPipeline
+	it RowIterator
+	// Known from the first row
+	inputCols  []int
+	targetCols []int
+	rowIdx     int
+}
+
+// Returns io.EOF after the last data point
+func (di *dataPointIterator) Next() (DataPoint, error) {
+	row, err := di.it.Next()
+	if err != nil {
+		return DataPoint{}, err
+	}
+	if di.inputCols == nil {
+		di.inputCols, di.targetCols = di.dp.inputAndTargetColumns(len(row))
+	}
+	di.rowIdx++
+	return rowToDataPoint(row, di.rowIdx-1, di.inputCols, di.targetCols)
+}
+
+func (dp *DataPipeline) inputAndTargetColumns(nbCols int) (inputCols []int, targetCols []int) {
+	inputCols = make([]int, 0, nbCols)
+	targetCols = make([]int, 0, len(dp.targets))
+	for col := 0; col < nbCols; col++ {
+		if dp.targets.Contains(col) {
+			targetCols = append(targetCols, col)
+		} else if !dp.ignored.Contains(col) {
+			inputCols = append(inputCols, col)
+		}
+	}
+	return
+}
+
+// Replaces the null tokens by nil in the columns that are not ignored, and drops the rows having some if requested.
+// The rows are filtered in place.
+func (dp *DataPipeline) markMissing(rows [][]any) [][]any {
+	kept := rows[:0]
+	for row := range rows {
+		if !dp.markMissingRow(rows[row]) || !dp.dropMissingRows {
+			kept = append(kept, rows[row])
+		}
+	}
+	return kept
+}
+
+// Replaces the null tokens by nil in the columns that are not ignored, returns whether the row has missing values
+func (dp *DataPipeline) markMissingRow(row []any) (missing bool) {
+	for col := range row {
+		if dp.ignored.Contains(col) {
+			continue
+		}
+		if s, ok := row[col].(string); ok && dp.nullTokens.Contains(s) {
+			row[col] = nil
+		}
+		missing = missing || row[col] == nil
+	}
+	return
+}
+
+// Adds a processor on specific columns. The ignored columns are never processed, even if specified here.
 func (dp *DataPipeline) AddColumnProcessor(cols []int, pp PipelineProcessor) {
 	for _, col := range cols {
-		dp.processors[col] = append(dp.processors[col], pp())
+		dp.factories[col] = append(dp.factories[col], pp)
+	}
+}
+
+// Same as AddColumnProcessor, with the columns referenced by name. The pipeline must be created from a schema.
+func (dp *DataPipeline) AddNamedColumnProcessor(names []string, pp PipelineProcessor) error {
+	if dp.schema == nil {
+		return errors.New("the pipeline has no schema, see NewDataPipelineFromSchema")
+	}
+	cols, err := dp.schema.Indices(names)
+	if err != nil {
+		return err
 	}
+	dp.AddColumnProcessor(cols, pp)
+	return nil
 }
 
-// Adds a ValueProcessor on all the columns
+// Adds a processor on all the columns, except the ignored ones
 func (dp *DataPipeline) AddRowProcessor(pp PipelineProcessor) {
-	for i := range dp.processors {
-		dp.processors[i] = append(dp.processors[i], pp())
+	for i := range dp.factories {
+		if !dp.ignored.Contains(i) {
+			dp.factories[i] = append(dp.factories[i], pp)
+		}
 	}
 }
 
-// Adds a ValueProcessor on all the inputs
+// Adds a processor on all the inputs (i.e. the columns neither targets nor ignored)
 func (dp *DataPipeline) AddInputProcessor(pp PipelineProcessor) {
-	for i := range dp.processors {
-		if !dp.targets.Contains(i) {
-			dp.processors[i] = append(dp.processors[i], pp())
+	for i := range dp.factories {
+		if !dp.targets.Contains(i) && !dp.ignored.Contains(i) {
+			dp.factories[i] = append(dp.factories[i], pp)
 		}
 	}
 }
 
-// Adds a ValueProcessor on all the inputs
+// Adds a processor on all the targets
 func (dp *DataPipeline) AddTargetProcessor(pp PipelineProcessor) {
-	for i := range dp.processors {
-		dp.processors[i] = append(dp.processors[i], pp())
+	for i := range dp.factories {
+		if dp.targets.Contains(i) {
+			dp.factories[i] = append(dp.factories[i], pp)
+		}
 	}
 }
 
 func PPStringValueMapper(dictionarySize int) PipelineProcessor {
-	return func() ValueProcessor {
+	return func() ColumnProcessor {
 		dict := make(map[string]float64, 0)
 		return TypedValueProcessor(func(v string) (any, error) {
 			if f, ok := dict[v]; ok {
@@ -114,7 +480,7 @@ func PPStringValueMapper(dictionarySize int) PipelineProcessor {
 }
 
 func PPNormalizer() PipelineProcessor {
-	return func() ValueProcessor {
+	return func() ColumnProcessor {
 		return TypedValueProcessor(func(v float64) (any, error) {
 			return float64(v / (1 + math.Abs(v))), nil
 		})
@@ -122,8 +488,8 @@ func PPNormalizer() PipelineProcessor {
 }
 
 func PPToFloats() PipelineProcessor {
-	return func() ValueProcessor {
-		return func(value any) (any, error) {
+	return func() ColumnProcessor {
+		return ValueProcessor(func(value any) (any, error) {
 			switch v := value.(type) {
 			case float64:
 				return v, nil
@@ -134,6 +500,82 @@ func PPToFloats() PipelineProcessor {
 			default:
 				return nil, fmt.Errorf("unsupported type in PPToFloats: %T", v)
 			}
-		}
+		})
+	}
+}
+
+// Standardizes the values of the column: (v - mean) / standard deviation.
+// A constant column is only centered.
+func PPStandardScaler() PipelineProcessor {
+	return func() ColumnProcessor {
+		return &standardScaler{}
+	}
+}
+
+type standardScaler struct {
+	// Welford's online algorithm, see https://en.wikipedia.org/wiki/Algorithms_for_calculating_variance
+	n    int
+	mean float64
+	m2   float64
+}
+
+func (s *standardScaler) Fit(value any) error {
+	v, ok := value.(float64)
+	if !ok {
+		return fmt.Errorf("not a float64")
+	}
+	s.n++
+	delta := v - s.mean
+	s.mean += delta / float64(s.n)
+	s.m2 += delta * (v - s.mean)
+	return nil
+}
+
+func (s *standardScaler) Transform(value any) (any, error) {
+	v, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("not a float64")
+	}
+	stdDev := float64(0)
+	if s.n > 0 {
+		stdDev = math.Sqrt(s.m2 / float64(s.n))
+	}
+	if stdDev == 0 {
+		return v - s.mean, nil
+	}
+	return (v - s.mean) / stdDev, nil
+}
+
+// Scales the values of the column to [0, 1]: (v - min) / (max - min).
+// Values outside of the fitted range (e.g. in test data) are scaled beyond [0, 1]. A constant column becomes 0.
+func PPMinMaxScaler() PipelineProcessor {
+	return func() ColumnProcessor {
+		return &minMaxScaler{math.Inf(1), math.Inf(-1)}
+	}
+}
+
+type minMaxScaler struct {
+	min float64
+	max float64
+}
+
+func (s *minMaxScaler) Fit(value any) error {
+	v, ok := value.(float64)
+	if !ok {
+		return fmt.Errorf("not a float64")
+	}
+	s.min = math.Min(s.min, v)
+	s.max = math.Max(s.max, v)
+	return nil
+}
+
+func (s *minMaxScaler) Transform(value any) (any, error) {
+	v, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("not a float64")
+	}
+	if s.max <= s.min {
+		return float64(0), nil
 	}
+	return (v - s.min) / (s.max - s.min), nil
 }
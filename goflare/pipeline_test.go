@@ -0,0 +1,212 @@
+package goflare
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Appends the tag to the string values, to see which columns were processed
+func ppTag(tag string) PipelineProcessor {
+	return func() ColumnProcessor {
+		return TypedValueProcessor(func(v string) (any, error) {
+			return v + tag, nil
+		})
+	}
+}
+
+func TestDataPipelineAddProcessors(t *testing.T) {
+	assert := assert.New(t)
+	// Columns: 0 ignored, 1 and 2 inputs, 3 target
+	newRows := func() [][]any {
+		return [][]any{{"a", "b", "c", "d"}, {"e", "f", "g", "h"}}
+	}
+	tests := []struct {
+		name     string
+		add      func(dp *DataPipeline)
+		expected [][]any
+	}{
+		{
+			"Column processor",
+			func(dp *DataPipeline) { dp.AddColumnProcessor([]int{0, 2}, ppTag("+")) },
+			[][]any{{"a", "b", "c+", "d"}, {"e", "f", "g+", "h"}},
+		},
+		{
+			"Row processor",
+			func(dp *DataPipeline) { dp.AddRowProcessor(ppTag("+")) },
+			[][]any{{"a", "b+", "c+", "d+"}, {"e", "f+", "g+", "h+"}},
+		},
+		{
+			"Input processor",
+			func(dp *DataPipeline) { dp.AddInputProcessor(ppTag("+")) },
+			[][]any{{"a", "b+", "c+", "d"}, {"e", "f+", "g+", "h"}},
+		},
+		{
+			"Target processor",
+			func(dp *DataPipeline) { dp.AddTargetProcessor(ppTag("+")) },
+			[][]any{{"a", "b", "c", "d+"}, {"e", "f", "g", "h+"}},
+		},
+		{
+			"Processors are applied in order",
+			func(dp *DataPipeline) {
+				dp.AddInputProcessor(ppTag("1"))
+				dp.AddRowProcessor(ppTag("2"))
+			},
+			[][]any{{"a", "b12", "c12", "d2"}, {"e", "f12", "g12", "h2"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dp := NewDataPipeline(4, []int{3}, IgnoreColumns([]int{0}))
+			tt.add(dp)
+			rows := newRows()
+			_, err := dp.Apply(rows)
+			assert.NoError(err)
+			assert.Equal(tt.expected, rows)
+		})
+	}
+}
+
+func TestDataStreamIgnoredColumns(t *testing.T) {
+	assert := assert.New(t)
+	ds := NewDataStream(2)
+	ds.data = append(ds.data, []any{"id1", "1", "2", "0"}, []any{"id2", "3", "4", "1"})
+
+	dp := NewDataPipeline(4, []int{3}, IgnoreColumns([]int{0}))
+	dp.AddRowProcessor(PPToFloats())
+	assert.NoError(ds.ApplyPipeline(dp))
+	dataset, err := ds.ToDataset([]int{3})
+	assert.NoError(err)
+	assert.Equal(Dataset{
+		{Inputs: []float64{1, 2}, Outputs: []float64{0}},
+		{Inputs: []float64{3, 4}, Outputs: []float64{1}},
+	}, dataset)
+
+	t.Run("Processing error", func(t *testing.T) {
+		ds := NewDataStream(1)
+		ds.data = append(ds.data, []any{"id1", "x", "2", "0"})
+		assert.ErrorContains(ds.ApplyPipeline(dp), "cannot process row 0 col 1")
+	})
+}
+
+func TestDataPipelineFit(t *testing.T) {
+	assert := assert.New(t)
+	dp := NewDataPipeline(3, []int{2})
+	dp.AddRowProcessor(PPToFloats())
+	dp.AddColumnProcessor([]int{0}, PPStandardScaler())
+	dp.AddColumnProcessor([]int{1}, PPMinMaxScaler())
+
+	train := [][]any{{"1", "10", "0"}, {"3", "20", "1"}, {"5", "30", "0"}}
+	_, err := dp.Apply(train)
+	assert.NoError(err)
+	std := math.Sqrt(8.0 / 3)
+	assert.InDeltaSlice([]float64{-2 / std, 0, 2 / std}, []float64{train[0][0].(float64), train[1][0].(float64), train[2][0].(float64)}, 1e-9)
+	assert.Equal([]any{0.0, 0.5, 1.0}, []any{train[0][1], train[1][1], train[2][1]})
+
+	// The test data reuses the state fitted on the train data
+	test := [][]any{{"3", "40", "1"}}
+	_, err = dp.Apply(test)
+	assert.NoError(err)
+	assert.Equal([][]any{{0.0, 1.5, 1.0}}, test)
+
+	t.Run("Refit", func(t *testing.T) {
+		rows := [][]any{{"0", "0", "0"}, {"2", "10", "0"}}
+		_, err := dp.FitApply(rows)
+		assert.NoError(err)
+		assert.Equal([][]any{{-1.0, 0.0, 0.0}, {1.0, 1.0, 0.0}}, rows)
+	})
+
+	t.Run("Not fitted", func(t *testing.T) {
+		_, err := NewDataPipeline(1, nil).Transform([][]any{{"1"}})
+		assert.EqualError(err, "the pipeline is not fitted")
+	})
+}
+
+func TestDataPipelineEncoders(t *testing.T) {
+	assert := assert.New(t)
+	targetEncoder := NewTargetEncoder()
+	dp := NewDataPipeline(4, []int{3})
+	dp.AddColumnProcessor([]int{0}, PPOneHotEncoder())
+	dp.AddColumnProcessor([]int{1}, PPLabelEncoder())
+	dp.AddColumnProcessor([]int{2}, PPToFloats())
+	dp.AddTargetProcessor(targetEncoder.Processor())
+
+	ds := NewDataStream(3)
+	ds.data = append(ds.data,
+		[]any{"red", "small", "1", "dog"},
+		[]any{"green", "large", "2", "cat"},
+		[]any{"blue", "small", "3", "bird"},
+	)
+	assert.NoError(ds.ApplyPipeline(dp))
+	dataset, err := ds.ToDataset([]int{3})
+	assert.NoError(err)
+	assert.Equal(Dataset{
+		{Inputs: []float64{0, 0, 1, 1, 1}, Outputs: []float64{0, 0, 1}},
+		{Inputs: []float64{0, 1, 0, 0, 2}, Outputs: []float64{0, 1, 0}},
+		{Inputs: []float64{1, 0, 0, 1, 3}, Outputs: []float64{1, 0, 0}},
+	}, dataset)
+	assert.Equal([]string{"bird", "cat", "dog"}, targetEncoder.Classes())
+
+	t.Run("Unknown categories", func(t *testing.T) {
+		rows := [][]any{{"yellow", "small", "1", "cat"}}
+		_, err := dp.Apply(rows)
+		assert.NoError(err)
+		assert.Equal([]any{[]float64{0, 0, 0}, 1.0, 1.0, []float64{0, 1, 0}}, rows[0])
+		_, err = dp.Apply([][]any{{"red", "medium", "1", "cat"}})
+		assert.ErrorContains(err, "unknown category medium")
+		_, err = dp.Apply([][]any{{"red", "small", "1", "fish"}})
+		assert.ErrorContains(err, "unknown category fish")
+	})
+}
+
+func TestDataPipelineMissingValues(t *testing.T) {
+	assert := assert.New(t)
+	newRows := func() [][]any {
+		return [][]any{
+			{"1", "a", "1", "10", "0"},
+			{"", "b", "NA", "", "1"},
+			{"3", "?", "4", "20", "0"},
+			{"8", "b", "", "30", "1"},
+		}
+	}
+
+	dp := NewDataPipeline(5, []int{4}, NullTokens("", "NA", "?"))
+	dp.AddColumnProcessor([]int{0, 2, 3, 4}, PPToFloats())
+	dp.AddColumnProcessor([]int{0}, PPImputer(ImputeMean))
+	dp.AddColumnProcessor([]int{1}, PPImputer(ImputeMostFrequent))
+	dp.AddColumnProcessor([]int{2}, PPImputer(ImputeMedian, WithMissingIndicator()))
+	dp.AddColumnProcessor([]int{3}, PPImputer(ImputeConstant, WithFillValue(-1.0)))
+	rows, err := dp.Apply(newRows())
+	assert.NoError(err)
+	assert.Equal([][]any{
+		{1.0, "a", []float64{1, 0}, 10.0, 0.0},
+		{4.0, "b", []float64{2.5, 1}, -1.0, 1.0},
+		{3.0, "b", []float64{4, 0}, 20.0, 0.0},
+		{8.0, "b", []float64{2.5, 1}, 30.0, 1.0},
+	}, rows)
+
+	t.Run("Unsupported values", func(t *testing.T) {
+		imp := PPImputer(ImputeMostFrequent)()
+		assert.EqualError(imp.Fit([]float64{1, 0}), "unsupported value type []float64")
+	})
+
+	t.Run("Drop rows", func(t *testing.T) {
+		dp := NewDataPipeline(5, []int{4}, NullTokens("", "NA", "?"), DropMissingRows(), IgnoreColumns([]int{1}))
+		dp.AddRowProcessor(PPToFloats())
+		rows, err := dp.Apply(newRows())
+		assert.NoError(err)
+		// The ignored column is not checked
+		assert.Equal([][]any{{1.0, "a", 1.0, 10.0, 0.0}, {3.0, "?", 4.0, 20.0, 0.0}}, rows)
+	})
+
+	t.Run("Not imputed", func(t *testing.T) {
+		dp := NewDataPipeline(2, []int{1})
+		dp.AddRowProcessor(PPToFloats())
+		ds := NewDataStream(2)
+		ds.data = append(ds.data, []any{"1", "0"}, []any{"", "1"})
+		assert.NoError(ds.ApplyPipeline(dp))
+		_, err := ds.ToDataset([]int{1})
+		assert.EqualError(err, "value at row 1, col 0 is missing")
+	})
+}
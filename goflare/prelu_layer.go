@@ -0,0 +1,133 @@
+package goflare
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jjunac/goflare/utils"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Parametric ReLU: same as LeakyReLU, but the slope of the negative values is learnt, one per value.
+// Being trainable, it is a layer of its own, typically put after a DenseLayer with the Linear activation.
+// See https://arxiv.org/abs/1502.01852
+type PReLULayer struct {
+	Size   int
+	Alphas []float64
+}
+
+// Initial slope of the negative values
+const preluInitialAlpha = 0.25
+
+func init() {
+	RegisterLayerType("PReLU", func() Layer { return &PReLULayer{} })
+}
+
+func NewPReLULayer(size int) *PReLULayer {
+	l := &PReLULayer{
+		Size:   size,
+		Alphas: make([]float64, size),
+	}
+	l.Reset()
+	return l
+}
+
+func (l *PReLULayer) InputSize() int {
+	return l.Size
+}
+
+func (l *PReLULayer) OutputSize() int {
+	return l.Size
+}
+
+func (l *PReLULayer) Copy() Layer {
+	return &PReLULayer{
+		Size:   l.Size,
+		Alphas: utils.CopySlice(l.Alphas),
+	}
+}
+
+// Checks that the parameters have the declared shape, since they can come from a file
+func (l *PReLULayer) UnmarshalJSON(data []byte) error {
+	type preluLayer PReLULayer // Without the methods, to avoid recursing
+	if err := json.Unmarshal(data, (*preluLayer)(l)); err != nil {
+		return err
+	}
+	if len(l.Alphas) != l.Size {
+		return fmt.Errorf("prelu layer of size %d has %d alphas", l.Size, len(l.Alphas))
+	}
+	return nil
+}
+
+func (l *PReLULayer) Parameters() [][]float64 {
+	return [][]float64{l.Alphas}
+}
+
+func (l *PReLULayer) Evaluate(inputs []float64) (outputs []float64) {
+	outputs = make([]float64, l.Size)
+	for i, input := range inputs {
+		if input > 0 {
+			outputs[i] = input
+		} else {
+			outputs[i] = l.Alphas[i] * input
+		}
+	}
+	return
+}
+
+func (l *PReLULayer) EvaluateWithLearnData(inputs []float64, learnData *LayerLearnData) (outputs []float64) {
+	learnData.Inputs = inputs
+	outputs = l.Evaluate(inputs)
+	learnData.Outputs = outputs
+	return
+}
+
+func (l *PReLULayer) Backward(outputsGradient []float64, learnData *LayerLearnData, gradients [][]float64) (inputsGradient []float64) {
+	inputsGradient = make([]float64, l.Size)
+	gradientAlphas := gradients[0]
+	for i, input := range learnData.Inputs {
+		if input > 0 {
+			inputsGradient[i] = outputsGradient[i]
+		} else {
+			inputsGradient[i] = l.Alphas[i] * outputsGradient[i]
+			gradientAlphas[i] += input * outputsGradient[i]
+		}
+	}
+	learnData.LossDerivative = inputsGradient
+	return
+}
+
+func (l *PReLULayer) EvaluateBatch(inputs *mat.Dense) (outputs *mat.Dense) {
+	rows, _ := inputs.Dims()
+	outputs = mat.NewDense(rows, l.Size, nil)
+	for i := 0; i < rows; i++ {
+		copy(outputs.RawRowView(i), l.Evaluate(inputs.RawRowView(i)))
+	}
+	return
+}
+
+func (l *PReLULayer) EvaluateBatchWithLearnData(inputs *mat.Dense, learnData *BatchLayerLearnData) (outputs *mat.Dense) {
+	learnData.Inputs = inputs
+	outputs = l.EvaluateBatch(inputs)
+	learnData.Outputs = outputs
+	return
+}
+
+func (l *PReLULayer) BackwardBatch(outputsGradient *mat.Dense, learnData *BatchLayerLearnData, gradients [][]float64) (inputsGradient *mat.Dense) {
+	rows, _ := outputsGradient.Dims()
+	inputsGradient = mat.NewDense(rows, l.Size, nil)
+	rowLearnData := LayerLearnData{}
+	for i := 0; i < rows; i++ {
+		rowLearnData.Inputs = learnData.Inputs.RawRowView(i)
+		copy(inputsGradient.RawRowView(i), l.Backward(outputsGradient.RawRowView(i), &rowLearnData, gradients))
+	}
+	learnData.LossDerivative = inputsGradient
+	return
+}
+
+func (l *PReLULayer) Reset() {
+	for i := range l.Alphas {
+		l.Alphas[i] = preluInitialAlpha
+	}
+}
@@ -0,0 +1,103 @@
+package goflare
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Keeps the weights of a layer small, to limit overfitting. Only the weights of the layers implementing WeightedLayer
+// are regularized. See Optimizer.SetRegularization.
+type Regularization struct {
+	// Coupled L2: adds L2 / 2 * sum(w²) to the loss of each data point. Its gradient goes through the optimizer like
+	// the loss one, e.g. it is divided by the moments of Adam.
+	L2 float64
+	// Adds L1 * sum(|w|) to the loss of each data point, which pushes the weights towards exactly 0
+	L1 float64
+	// Decoupled L2 (AdamW style): each step shrinks the weights by learnRate * WeightDecay * w, independently of the
+	// gradients. It is not a term of the loss. See https://arxiv.org/abs/1711.05101
+	WeightDecay float64
+	// Maximum L2 norm of the weights of each output (a column of WeightedLayer.WeightsMatrix), which are scaled down
+	// after each step when exceeding it. 0 means no constraint.
+	MaxNorm float64
+}
+
+// Returns the term added to the loss of each data point
+func (r *Regularization) penalty(weights []float64) float64 {
+	if r.L1 == 0 && r.L2 == 0 {
+		return 0
+	}
+	penalty := float64(0)
+	for _, w := range weights {
+		penalty += r.L1*math.Abs(w) + r.L2/2*w*w
+	}
+	return penalty
+}
+
+// Adds the gradient of the penalty to the gradient of the weights, which is summed over nbDataPoints
+func (r *Regularization) addGradient(weights []float64, gradient []float64, nbDataPoints int) {
+	if r.L1 == 0 && r.L2 == 0 {
+		return
+	}
+	n := float64(nbDataPoints)
+	for i, w := range weights {
+		sign := float64(0)
+		if w > 0 {
+			sign = 1
+		} else if w < 0 {
+			sign = -1
+		}
+		gradient[i] += n * (r.L1*sign + r.L2*w)
+	}
+}
+
+func (r *Regularization) decay(weights []float64, learnRate float64) {
+	if r.WeightDecay == 0 {
+		return
+	}
+	for i := range weights {
+		weights[i] -= learnRate * r.WeightDecay * weights[i]
+	}
+}
+
+func (r *Regularization) constrain(weights *mat.Dense) {
+	if r.MaxNorm <= 0 {
+		return
+	}
+	rows, cols := weights.Dims()
+	for j := 0; j < cols; j++ {
+		if norm := mat.Norm(weights.ColView(j), 2); norm > r.MaxNorm {
+			for i := 0; i < rows; i++ {
+				weights.Set(i, j, weights.At(i, j)*r.MaxNorm/norm)
+			}
+		}
+	}
+}
+
+func (o *optimizerBase) SetRegularization(r Regularization) {
+	for i := range o.regularizations {
+		o.regularizations[i] = r
+	}
+}
+
+func (o *optimizerBase) SetLayerRegularization(iLayer int, r Regularization) {
+	o.regularizations[iLayer] = r
+}
+
+func (o *optimizerBase) RegularizationLoss() float64 {
+	penalty := float64(0)
+	for iLayer := range o.nn.Layers {
+		if l := o.regularizedLayer(iLayer); l != nil {
+			penalty += o.regularizations[iLayer].penalty(l.Parameters()[0])
+		}
+	}
+	return penalty
+}
+
+// Returns nil if the layer can't be regularized
+func (o *optimizerBase) regularizedLayer(iLayer int) WeightedLayer {
+	if l, ok := o.nn.Layers[iLayer].(WeightedLayer); ok {
+		return l
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package goflare
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/jjunac/goflare/utils"
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestRegularization(t *testing.T) {
+	assert := assert.New(t)
+	rng := rand.New(rand.NewSource(3))
+	data := utils.InitSlice(6, func(i int) DataPoint {
+		return DataPoint{
+			Inputs:  utils.InitSlice(3, func(i int) float64 { return rng.Float64() }),
+			Outputs: []float64{rng.Float64(), rng.Float64()},
+		}
+	})
+	initial := NewNetwork([]Layer{NewDenseLayer(3, 4, Sigmoid, WithRand(rng)), NewDenseLayer(4, 2, Linear, WithRand(rng))})
+	const learnRate = 0.1
+
+	// Trains a copy of the initial network on one batch, returning it with the reported loss
+	train := func(unbatched bool, setup func(o Optimizer)) (Network, float64) {
+		n := CopyNetwork(&initial)
+		o := NewSGD(&n, MSELoss, learnRate, 0)
+		setup(o)
+		loss := (&NetworkTrainer{NbWorkers: 2, Unbatched: unbatched}).Train(&n, NewDataLoader(data, len(data), false), o)
+		return n, loss
+	}
+	reference, referenceLoss := train(false, func(o Optimizer) {})
+	weights := func(n Network, iLayer int) []float64 { return n.Layers[iLayer].Parameters()[0] }
+
+	for _, unbatched := range []bool{false, true} {
+		// Coupled: the gradient of the penalty of each data point is added to the loss one
+		n, loss := train(unbatched, func(o Optimizer) { o.SetRegularization(Regularization{L1: 0.01, L2: 0.1}) })
+		penalty := float64(0)
+		for iLayer := range initial.Layers {
+			for i, w := range weights(initial, iLayer) {
+				penalty += 0.01*math.Abs(w) + 0.05*w*w
+				expected := weights(reference, iLayer)[i] - learnRate*float64(len(data))*(0.01*math.Copysign(1, w)+0.1*w)
+				assert.InDelta(expected, weights(n, iLayer)[i], 1e-9)
+			}
+			// The biases are not regularized
+			assert.InDeltaSlice(reference.Layers[iLayer].Parameters()[1], n.Layers[iLayer].Parameters()[1], 1e-9)
+		}
+		assert.InDelta(referenceLoss+penalty, loss, 1e-9)
+
+		// Decoupled: shrinks the weights, independently of the number of data points, without changing the loss
+		n, loss = train(unbatched, func(o Optimizer) { o.SetLayerRegularization(1, Regularization{WeightDecay: 0.5}) })
+		assert.InDeltaSlice(weights(reference, 0), weights(n, 0), 1e-9)
+		for i, w := range weights(initial, 1) {
+			assert.InDelta(weights(reference, 1)[i]-learnRate*0.5*w, weights(n, 1)[i], 1e-9)
+		}
+		assert.InDelta(referenceLoss, loss, 1e-9)
+	}
+
+	// Max-norm: the weights of each output are scaled down to the max norm
+	n, _ := train(false, func(o Optimizer) { o.SetLayerRegularization(0, Regularization{MaxNorm: 0.5}) })
+	for j := 0; j < 4; j++ {
+		col := mat.Col(nil, j, n.Layers[0].(*DenseLayer).WeightsMatrix())
+		expected := mat.Col(nil, j, reference.Layers[0].(*DenseLayer).WeightsMatrix())
+		norm := mat.Norm(mat.NewVecDense(len(expected), expected), 2)
+		if norm > 0.5 {
+			for i := range expected {
+				expected[i] *= 0.5 / norm
+			}
+		}
+		assert.InDeltaSlice(expected, col, 1e-9)
+	}
+	assert.InDeltaSlice(weights(reference, 1), weights(n, 1), 1e-9)
+}
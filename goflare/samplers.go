@@ -0,0 +1,219 @@
+package goflare
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Chooses the data points of each epoch of a DataLoader
+type Sampler interface {
+	// Returns the indices of the data points of an epoch, in order. They can be repeated or left out.
+	Indices(dataset Dataset, rng *rand.Rand) ([]int, error)
+}
+
+// Takes all the data points in a random order
+type RandomSampler struct{}
+
+func (RandomSampler) Indices(dataset Dataset, rng *rand.Rand) ([]int, error) {
+	return rng.Perm(len(dataset)), nil
+}
+
+// Draws data points with replacement, proportionally to their weight
+type WeightedRandomSampler struct {
+	// Weight of each data point, non-negative with a positive sum, see NewWeightedRandomSampler
+	Weights []float64
+	// Number of data points drawn per epoch, the size of the dataset by default
+	NbSamples int
+}
+
+// Checks the weights, which must be non-negative with a positive sum
+func NewWeightedRandomSampler(weights []float64, nbSamples int) (WeightedRandomSampler, error) {
+	if err := checkWeights(weights); err != nil {
+		return WeightedRandomSampler{}, err
+	}
+	return WeightedRandomSampler{Weights: weights, NbSamples: nbSamples}, nil
+}
+
+// Checks the weights again, since the sampler may not come from NewWeightedRandomSampler, and that there is one per
+// data point of the dataset
+func (s WeightedRandomSampler) Indices(dataset Dataset, rng *rand.Rand) ([]int, error) {
+	if len(s.Weights) != len(dataset) {
+		return nil, fmt.Errorf("weighted random sampler has %d weights for %d data points", len(s.Weights), len(dataset))
+	}
+	if err := checkWeights(s.Weights); err != nil {
+		return nil, err
+	}
+	return weightedDraw(s.Weights, s.NbSamples, len(dataset), rng), nil
+}
+
+func checkWeights(weights []float64) error {
+	total := float64(0)
+	for i, w := range weights {
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return fmt.Errorf("invalid weight %g of data point %d", w, i)
+		}
+		total += w
+	}
+	if total <= 0 {
+		return fmt.Errorf("the weights must have a positive sum")
+	}
+	return nil
+}
+
+// Same as WeightedRandomSampler, the weight of each data point being the inverse of the frequency of its class
+// (see classKey), so that each class is drawn as often on average
+type ClassBalancedSampler struct {
+	// Number of data points drawn per epoch, the size of the dataset by default
+	NbSamples int
+}
+
+func (s ClassBalancedSampler) Indices(dataset Dataset, rng *rand.Rand) ([]int, error) {
+	weights := make([]float64, len(dataset))
+	for _, indices := range classIndices(dataset) {
+		for _, i := range indices {
+			weights[i] = 1 / float64(len(indices))
+		}
+	}
+	return weightedDraw(weights, s.NbSamples, len(dataset), rng), nil
+}
+
+// The weights must have a positive sum if there are some, see checkWeights
+func weightedDraw(weights []float64, nbSamples int, datasetSize int, rng *rand.Rand) []int {
+	if nbSamples <= 0 {
+		nbSamples = datasetSize
+	}
+	if len(weights) == 0 {
+		return []int{}
+	}
+	cumul := make([]float64, len(weights))
+	total := float64(0)
+	for i, w := range weights {
+		total += w
+		cumul[i] = total
+	}
+	indices := make([]int, nbSamples)
+	for i := range indices {
+		indices[i] = sort.SearchFloat64s(cumul, rng.Float64()*total)
+		// The draw can't be exactly total, but the rounding of the sums could give the last index + 1
+		if indices[i] >= len(weights) {
+			indices[i] = len(weights) - 1
+		}
+	}
+	return indices
+}
+
+// Takes all the data points, and repeats random ones of the minority classes until each class has as many data points
+// as the majority one
+type RandomOverSampler struct{}
+
+func (RandomOverSampler) Indices(dataset Dataset, rng *rand.Rand) ([]int, error) {
+	byClass := classIndices(dataset)
+	maxCount := 0
+	for _, indices := range byClass {
+		if len(indices) > maxCount {
+			maxCount = len(indices)
+		}
+	}
+	sampled := make([]int, 0, maxCount*len(byClass))
+	for _, indices := range byClass {
+		sampled = append(sampled, indices...)
+		for i := len(indices); i < maxCount; i++ {
+			sampled = append(sampled, indices[rng.Intn(len(indices))])
+		}
+	}
+	rng.Shuffle(len(sampled), func(i, j int) { sampled[i], sampled[j] = sampled[j], sampled[i] })
+	return sampled, nil
+}
+
+// Takes as many random data points of each class as there are in the minority class, a different subset each epoch
+type RandomUnderSampler struct{}
+
+func (RandomUnderSampler) Indices(dataset Dataset, rng *rand.Rand) ([]int, error) {
+	byClass := classIndices(dataset)
+	minCount := len(dataset)
+	for _, indices := range byClass {
+		if len(indices) < minCount {
+			minCount = len(indices)
+		}
+	}
+	sampled := make([]int, 0, minCount*len(byClass))
+	for _, indices := range byClass {
+		rng.Shuffle(len(indices), func(i, j int) { indices[i], indices[j] = indices[j], indices[i] })
+		sampled = append(sampled, indices[:minCount]...)
+	}
+	rng.Shuffle(len(sampled), func(i, j int) { sampled[i], sampled[j] = sampled[j], sampled[i] })
+	return sampled, nil
+}
+
+// Synthetic Minority Over-sampling TEchnique: returns the dataset with synthetic data points added to the minority
+// classes, until each class has as many data points as the majority one. Each synthetic data point is interpolated
+// between a random data point of the class and one of its k nearest neighbours in the class (euclidean distance of
+// the inputs). See https://arxiv.org/abs/1106.1813
+func SMOTE(dataset Dataset, k int, rng *rand.Rand) Dataset {
+	byClass := classIndices(dataset)
+	maxCount := 0
+	for _, indices := range byClass {
+		if len(indices) > maxCount {
+			maxCount = len(indices)
+		}
+	}
+	augmented := make(Dataset, len(dataset), maxCount*len(byClass))
+	copy(augmented, dataset)
+	for _, indices := range byClass {
+		if len(indices) == maxCount {
+			continue
+		}
+		// Computed on demand, since only some of the data points may be drawn
+		neighbours := make(map[int][]int)
+		for n := len(indices); n < maxCount; n++ {
+			i := indices[rng.Intn(len(indices))]
+			if _, ok := neighbours[i]; !ok {
+				neighbours[i] = nearestNeighbours(dataset, i, indices, k)
+			}
+			point := DataPoint{
+				Inputs:  make([]float64, len(dataset[i].Inputs)),
+				Outputs: dataset[i].Outputs,
+			}
+			copy(point.Inputs, dataset[i].Inputs)
+			if len(neighbours[i]) > 0 {
+				neighbour := dataset[neighbours[i][rng.Intn(len(neighbours[i]))]].Inputs
+				gap := rng.Float64()
+				for j := range point.Inputs {
+					point.Inputs[j] += gap * (neighbour[j] - point.Inputs[j])
+				}
+			}
+			augmented = append(augmented, point)
+		}
+	}
+	return augmented
+}
+
+// Returns the k candidates the closest to the data point i, excluding itself
+func nearestNeighbours(dataset Dataset, i int, candidates []int, k int) []int {
+	type neighbour struct {
+		index    int
+		distance float64
+	}
+	neighbours := make([]neighbour, 0, len(candidates))
+	for _, c := range candidates {
+		if c == i {
+			continue
+		}
+		distance := float64(0)
+		for j, v := range dataset[c].Inputs {
+			distance += (v - dataset[i].Inputs[j]) * (v - dataset[i].Inputs[j])
+		}
+		neighbours = append(neighbours, neighbour{c, distance})
+	}
+	sort.Slice(neighbours, func(a, b int) bool { return neighbours[a].distance < neighbours[b].distance })
+	if len(neighbours) > k {
+		neighbours = neighbours[:k]
+	}
+	nearest := make([]int, len(neighbours))
+	for j := range neighbours {
+		nearest[j] = neighbours[j].index
+	}
+	return nearest
+}
@@ -0,0 +1,100 @@
+package goflare
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataLoaderIter(t *testing.T) {
+	assert := assert.New(t)
+	dataset := imbalancedDataset()[:10]
+	batchSizes := func(dl *DataLoader) (sizes []int) {
+		it := dl.Iter()
+		for batch, ok := it.Next(); ok; batch, ok = it.Next() {
+			sizes = append(sizes, len(batch))
+		}
+		return
+	}
+	assert.Equal([]int{4, 4, 2}, batchSizes(NewDataLoader(dataset, 4, false)))
+	assert.Equal([]int{4, 4}, batchSizes(NewDataLoader(dataset, 4, true, DropLast())))
+	assert.Equal([]int{5, 5}, batchSizes(NewDataLoader(dataset, 5, true, DropLast())))
+
+	// Each data point once per epoch, in a random order
+	batches := NewDataLoader(dataset, 3, true, WithSamplingSource(rand.New(rand.NewSource(42)))).Batches()
+	seen := make(map[float64]bool)
+	for _, batch := range batches {
+		for _, point := range batch {
+			seen[point.Inputs[0]] = true
+		}
+	}
+	assert.Len(seen, 10)
+}
+
+func TestSamplers(t *testing.T) {
+	assert := assert.New(t)
+	dataset := imbalancedDataset()
+	rng := rand.New(rand.NewSource(42))
+	countClasses := func(indices []int, err error) (counts [2]int) {
+		assert.NoError(err)
+		for _, i := range indices {
+			counts[int(classKey(dataset[i]))]++
+		}
+		return
+	}
+
+	assert.Equal([2]int{80, 80}, countClasses(RandomOverSampler{}.Indices(dataset, rng)))
+	assert.Equal([2]int{20, 20}, countClasses(RandomUnderSampler{}.Indices(dataset, rng)))
+
+	counts := countClasses(ClassBalancedSampler{NbSamples: 10000}.Indices(dataset, rng))
+	assert.InDelta(5000, counts[0], 200)
+
+	weights := make([]float64, len(dataset))
+	weights[3] = 1
+	indices, err := WeightedRandomSampler{Weights: weights, NbSamples: 3}.Indices(dataset, rng)
+	assert.NoError(err)
+	assert.Equal([]int{3, 3, 3}, indices)
+	sampler, err := NewWeightedRandomSampler(weights, 3)
+	assert.NoError(err)
+	indices, err = sampler.Indices(dataset, rng)
+	assert.NoError(err)
+	assert.Equal([]int{3, 3, 3}, indices)
+	_, err = NewWeightedRandomSampler(make([]float64, 3), 0)
+	assert.EqualError(err, "the weights must have a positive sum")
+	_, err = NewWeightedRandomSampler([]float64{1, -1}, 0)
+	assert.EqualError(err, "invalid weight -1 of data point 1")
+	indices, err = ClassBalancedSampler{NbSamples: 5}.Indices(Dataset{}, rng)
+	assert.NoError(err)
+	assert.Empty(indices)
+
+	// The samplers built without NewWeightedRandomSampler are checked when the loader starts an epoch
+	for _, tt := range []struct {
+		sampler  WeightedRandomSampler
+		expected string
+	}{
+		{WeightedRandomSampler{Weights: []float64{1, 1, 1}}, "weighted random sampler has 3 weights for 100 data points"},
+		{WeightedRandomSampler{Weights: make([]float64, len(dataset))}, "the weights must have a positive sum"},
+	} {
+		loader := NewDataLoader(dataset, 10, false, WithSampler(tt.sampler))
+		assert.Empty(loader.Batches())
+		assert.EqualError(loader.Err(), "cannot sample the data points: "+tt.expected)
+
+		network := NewNetwork([]Layer{NewDenseLayer(1, 2, Softmax)})
+		history, err := (&NetworkTrainer{NbWorkers: 1}).Fit(&network, loader, NewSGD(&network, CrossEntropyLoss, 0.1, 0), FitOptions{Epochs: 3})
+		assert.EqualError(err, "cannot train epoch 0: cannot sample the data points: "+tt.expected)
+		assert.Empty(history.Epochs)
+	}
+	assert.NoError(NewDataLoader(dataset, 10, false).Err())
+
+	t.Run("SMOTE", func(t *testing.T) {
+		augmented := SMOTE(dataset, 3, rng)
+		assert.Len(augmented, 160)
+		assert.Equal(dataset, augmented[:100])
+		for _, point := range augmented[100:] {
+			// The class 1 data points are multiples of 5, each synthetic one lies between 2 of them
+			assert.Equal([]float64{0, 1}, point.Outputs)
+			assert.True(point.Inputs[0] >= 0 && point.Inputs[0] <= 95)
+		}
+	})
+}
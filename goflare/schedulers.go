@@ -0,0 +1,150 @@
+package goflare
+
+import "math"
+
+type ScheduleUnit int
+
+const (
+	// The scheduler is consulted after each optimizer step
+	PerStep ScheduleUnit = iota
+	// The scheduler is consulted at the end of each epoch, see Optimizer.EndEpoch
+	PerEpoch
+)
+
+// A Scheduler adjusts the learning rate of an optimizer during the training, see Optimizer.SetScheduler
+type Scheduler interface {
+	// Returns the learning rate to use once t steps or epochs are done, given the initial and current learning rates.
+	// logs are the logs of the last epoch, nil when scheduling per step or before the first epoch.
+	LearnRate(initial float64, current float64, t int, logs EpochLogs) float64
+}
+
+// Multiplies the learning rate by Gamma every StepSize steps/epochs
+type StepDecay struct {
+	// At least 1, smaller values being treated as 1
+	StepSize int
+	Gamma    float64
+}
+
+func NewStepDecay(stepSize int, gamma float64) *StepDecay {
+	return &StepDecay{atLeastOne(stepSize), gamma}
+}
+
+func (s *StepDecay) LearnRate(initial float64, current float64, t int, logs EpochLogs) float64 {
+	return initial * math.Pow(s.Gamma, float64(t/atLeastOne(s.StepSize)))
+}
+
+// Multiplies the learning rate by Gamma every step/epoch
+type ExponentialDecay struct {
+	Gamma float64
+}
+
+func NewExponentialDecay(gamma float64) *ExponentialDecay {
+	return &ExponentialDecay{gamma}
+}
+
+func (s *ExponentialDecay) LearnRate(initial float64, current float64, t int, logs EpochLogs) float64 {
+	return initial * math.Pow(s.Gamma, float64(t))
+}
+
+// Cosine annealing from the initial learning rate down to MinLearnRate, restarting after Period steps/epochs.
+// The period is multiplied by PeriodMult after each restart. See https://arxiv.org/abs/1608.03983.
+type CosineAnnealingWarmRestarts struct {
+	// At least 1, smaller values being treated as 1
+	Period       int
+	PeriodMult   int
+	MinLearnRate float64
+}
+
+func NewCosineAnnealingWarmRestarts(period int, periodMult int, minLearnRate float64) *CosineAnnealingWarmRestarts {
+	return &CosineAnnealingWarmRestarts{atLeastOne(period), periodMult, minLearnRate}
+}
+
+func (s *CosineAnnealingWarmRestarts) LearnRate(initial float64, current float64, t int, logs EpochLogs) float64 {
+	// Find the position in the current period
+	period := atLeastOne(s.Period)
+	for t >= period {
+		t -= period
+		if s.PeriodMult > 1 {
+			period *= s.PeriodMult
+		}
+	}
+	return s.MinLearnRate + (initial-s.MinLearnRate)*(1+math.Cos(math.Pi*float64(t)/float64(period)))/2
+}
+
+// The periods are exported fields, so they are also checked when used, not only by the constructors
+func atLeastOne(period int) int {
+	if period < 1 {
+		return 1
+	}
+	return period
+}
+
+// Increases linearly the learning rate up to the initial one during Warmup steps/epochs, then hands over to Then
+// (if any, keeping the initial learning rate otherwise), which sees t starting back at 0.
+type LinearWarmup struct {
+	Warmup int
+	Then   Scheduler
+}
+
+func NewLinearWarmup(warmup int, then Scheduler) *LinearWarmup {
+	return &LinearWarmup{warmup, then}
+}
+
+func (s *LinearWarmup) LearnRate(initial float64, current float64, t int, logs EpochLogs) float64 {
+	if t < s.Warmup {
+		return initial * float64(t+1) / float64(s.Warmup)
+	}
+	if s.Then == nil {
+		return initial
+	}
+	return s.Then.LearnRate(initial, current, t-s.Warmup, logs)
+}
+
+// Multiplies the learning rate by Factor when the monitored metric stops improving for Patience epochs.
+// Only meaningful when scheduling per epoch.
+type ReduceOnPlateau struct {
+	// Name of the metric in the EpochLogs, e.g. "val_loss"
+	Monitor string
+	// Whether a higher value is better (e.g. for "val_accuracy")
+	Maximize bool
+	Factor   float64
+	Patience int
+	// Minimum change to be considered as an improvement
+	MinDelta     float64
+	MinLearnRate float64
+
+	// Whether best was set, so that the struct can be built without NewReduceOnPlateau
+	seen bool
+	best float64
+	wait int
+}
+
+func NewReduceOnPlateau(monitor string, factor float64, patience int) *ReduceOnPlateau {
+	return &ReduceOnPlateau{
+		Monitor:  monitor,
+		Factor:   factor,
+		Patience: patience,
+	}
+}
+
+func (s *ReduceOnPlateau) LearnRate(initial float64, current float64, t int, logs EpochLogs) float64 {
+	value, ok := logs[s.Monitor]
+	if !ok {
+		return current
+	}
+	if s.Maximize {
+		value = -value
+	}
+	if !s.seen || value < s.best-s.MinDelta {
+		s.seen = true
+		s.best = value
+		s.wait = 0
+		return current
+	}
+	s.wait++
+	if s.wait > s.Patience {
+		s.wait = 0
+		return math.Max(current*s.Factor, s.MinLearnRate)
+	}
+	return current
+}
@@ -0,0 +1,55 @@
+package goflare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulers(t *testing.T) {
+	assert := assert.New(t)
+	learnRates := func(s Scheduler, n int) []float64 {
+		res := make([]float64, n)
+		current := float64(1)
+		for i := range res {
+			current = s.LearnRate(1, current, i, nil)
+			res[i] = current
+		}
+		return res
+	}
+
+	assert.Equal([]float64{1, 1, 0.5, 0.5, 0.25}, learnRates(NewStepDecay(2, 0.5), 5))
+	assert.Equal([]float64{1, 0.5, 0.25, 0.125}, learnRates(NewExponentialDecay(0.5), 4))
+	assert.InDeltaSlice([]float64{1, 0.5, 1, 0.8535533905932737, 0.5, 0.14644660940672624}, learnRates(NewCosineAnnealingWarmRestarts(2, 2, 0), 6), 1e-9)
+	assert.Equal([]float64{0.25, 0.5, 0.75, 1, 1, 0.5}, learnRates(NewLinearWarmup(4, NewStepDecay(1, 0.5)), 6))
+	// A period of 0 is treated as 1, instead of dividing by 0 or looping forever
+	assert.Equal([]float64{1, 0.5, 0.25}, learnRates(NewStepDecay(0, 0.5), 3))
+	assert.Equal([]float64{1, 0.5, 0.25}, learnRates(&StepDecay{Gamma: 0.5}, 3))
+	assert.Equal([]float64{1, 1, 1}, learnRates(&CosineAnnealingWarmRestarts{}, 3))
+
+	t.Run("ReduceOnPlateau", func(t *testing.T) {
+		// Built with the constructor or as a struct literal
+		for _, s := range []*ReduceOnPlateau{NewReduceOnPlateau("val_loss", 0.1, 1), {Monitor: "val_loss", Factor: 0.1, Patience: 1}} {
+			current := float64(1)
+			for i, valLoss := range []float64{0.5, 0.4, 0.45, 0.45, 0.3, 0.2, 0.1} {
+				current = s.LearnRate(1, current, i, EpochLogs{"val_loss": valLoss})
+			}
+			assert.InDelta(0.1, current, 1e-9)
+		}
+	})
+
+	t.Run("Optimizer", func(t *testing.T) {
+		network := NewNetwork([]Layer{NewDenseLayer(1, 1, Sigmoid)})
+		optimizer := NewSGD(&network, MSELoss, 1, 0)
+		optimizer.SetScheduler(NewLinearWarmup(2, nil), PerStep)
+		assert.Equal(0.5, optimizer.LearnRate())
+		optimizer.Step()
+		assert.Equal(float64(1), optimizer.LearnRate())
+
+		optimizer.SetScheduler(NewExponentialDecay(0.5), PerEpoch)
+		optimizer.Step()
+		assert.Equal(float64(1), optimizer.LearnRate())
+		optimizer.EndEpoch(EpochLogs{})
+		assert.Equal(0.5, optimizer.LearnRate())
+	})
+}
@@ -0,0 +1,86 @@
+package goflare
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Kind of values held by a column, inferred from the data by DataStream.Schema
+type ColumnType int
+
+const (
+	// Only missing values
+	ColumnUnknown ColumnType = iota
+	// Floats, or strings parsable as floats
+	ColumnNumeric
+	// Any other value, e.g. class labels
+	ColumnCategorical
+)
+
+func (ct ColumnType) String() string {
+	switch ct {
+	case ColumnNumeric:
+		return "numeric"
+	case ColumnCategorical:
+		return "categorical"
+	default:
+		return "unknown"
+	}
+}
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// The columns of a DataStream, in order
+type Schema []Column
+
+// Returns the names of the columns
+func (s Schema) Names() []string {
+	names := make([]string, len(s))
+	for i := range s {
+		names[i] = s[i].Name
+	}
+	return names
+}
+
+// Returns the index of the column with the given name
+func (s Schema) Index(name string) (int, error) {
+	for i := range s {
+		if s[i].Name == name {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("unknown column %q", name)
+}
+
+// Returns the indices of the columns with the given names, in the same order
+func (s Schema) Indices(names []string) ([]int, error) {
+	indices := make([]int, len(names))
+	for i, name := range names {
+		var err error
+		if indices[i], err = s.Index(name); err != nil {
+			return nil, err
+		}
+	}
+	return indices, nil
+}
+
+// Returns the type of a value, ColumnUnknown for the missing ones
+func valueColumnType(value any) ColumnType {
+	switch v := value.(type) {
+	case nil:
+		return ColumnUnknown
+	case float64, float32, int, []float64:
+		return ColumnNumeric
+	case string:
+		if v == "" {
+			return ColumnUnknown
+		}
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return ColumnNumeric
+		}
+	}
+	return ColumnCategorical
+}
@@ -0,0 +1,255 @@
+package goflare
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Returns the data points at the given indices, e.g. of a Fold
+func (d Dataset) Subset(indices []int) Dataset {
+	subset := make(Dataset, len(indices))
+	for i, idx := range indices {
+		subset[i] = d[idx]
+	}
+	return subset
+}
+
+// Class of a data point: the index of the max output for one-hot outputs, or the output itself if there is a single one
+func classKey(point DataPoint) float64 {
+	if len(point.Outputs) == 1 {
+		return point.Outputs[0]
+	}
+	best := 0
+	for i, v := range point.Outputs {
+		if v > point.Outputs[best] {
+			best = i
+		}
+	}
+	return float64(best)
+}
+
+// Splits n elements into sizes following the proportions, the remainder going to the largest fractional parts
+func splitSizes(n int, proportions []float64) []int {
+	sum := float64(0)
+	for _, p := range proportions {
+		sum += p
+	}
+	sizes := make([]int, len(proportions))
+	fractions := make([]float64, len(proportions))
+	remaining := n
+	for i, p := range proportions {
+		exact := float64(n) * p / sum
+		sizes[i] = int(math.Floor(exact))
+		fractions[i] = exact - float64(sizes[i])
+		remaining -= sizes[i]
+	}
+	order := make([]int, len(proportions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return fractions[order[i]] > fractions[order[j]] })
+	for i := 0; i < remaining; i++ {
+		sizes[order[i%len(order)]]++
+	}
+	return sizes
+}
+
+// Little shortcut for ExactSplit with 2 datasets
+func ExactSplit2[T any](dataset []T, proportions ...float64) ([]T, []T) {
+	res := ExactSplit(dataset, proportions...)
+	return res[0], res[1]
+}
+
+// Same as RandomSplit, but the sizes of the datasets follow the proportions exactly (up to rounding),
+// instead of only on average
+func ExactSplit[T any](dataset []T, proportions ...float64) [][]T {
+	return ExactSplitWithSource(dataset, proportions, rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+func ExactSplitWithSource[T any](dataset []T, proportions []float64, rng *rand.Rand) [][]T {
+	perm := rng.Perm(len(dataset))
+	datasets := make([][]T, len(proportions))
+	start := 0
+	for i, size := range splitSizes(len(dataset), proportions) {
+		datasets[i] = make([]T, size)
+		for j := range datasets[i] {
+			datasets[i][j] = dataset[perm[start+j]]
+		}
+		start += size
+	}
+	return datasets
+}
+
+// Little shortcut for StratifiedSplit with 2 datasets
+func StratifiedSplit2(dataset Dataset, proportions ...float64) (Dataset, Dataset) {
+	res := StratifiedSplit(dataset, proportions...)
+	return res[0], res[1]
+}
+
+// Same as ExactSplit, but each class (see classKey) is split according to the proportions, so that the datasets keep
+// the class balance of the original one
+func StratifiedSplit(dataset Dataset, proportions ...float64) []Dataset {
+	return StratifiedSplitWithSource(dataset, proportions, rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+func StratifiedSplitWithSource(dataset Dataset, proportions []float64, rng *rand.Rand) []Dataset {
+	datasets := make([]Dataset, len(proportions))
+	for _, indices := range classIndices(dataset) {
+		rng.Shuffle(len(indices), func(i, j int) { indices[i], indices[j] = indices[j], indices[i] })
+		start := 0
+		for i, size := range splitSizes(len(indices), proportions) {
+			datasets[i] = append(datasets[i], dataset.Subset(indices[start:start+size])...)
+			start += size
+		}
+	}
+	// Mixing the classes, which are grouped otherwise
+	for _, d := range datasets {
+		rng.Shuffle(len(d), func(i, j int) { d[i], d[j] = d[j], d[i] })
+	}
+	return datasets
+}
+
+// Returns the indices of the data points of each class, the classes being sorted
+func classIndices(dataset Dataset) [][]int {
+	byClass := make(map[float64][]int)
+	for i := range dataset {
+		key := classKey(dataset[i])
+		byClass[key] = append(byClass[key], i)
+	}
+	classes := make([]float64, 0, len(byClass))
+	for c := range byClass {
+		classes = append(classes, c)
+	}
+	sort.Float64s(classes)
+	indices := make([][]int, len(classes))
+	for i, c := range classes {
+		indices[i] = byClass[c]
+	}
+	return indices
+}
+
+// Indices of the training and validation data points of a cross-validation fold
+type Fold struct {
+	Train      []int
+	Validation []int
+}
+
+// Splits n data points into k folds, each one being used once as validation. The data points are shuffled with rng,
+// unless it is nil.
+func KFold(n int, k int, rng *rand.Rand) ([]Fold, error) {
+	if k < 2 || k > n {
+		return nil, fmt.Errorf("cannot split %d data points into %d folds", n, k)
+	}
+	indices := make([]int, n)
+	for i := range indices {
+		indices[i] = i
+	}
+	if rng != nil {
+		rng.Shuffle(n, func(i, j int) { indices[i], indices[j] = indices[j], indices[i] })
+	}
+	validations := make([][]int, k)
+	start := 0
+	for i := range validations {
+		// The first n % k folds get an extra data point
+		size := n / k
+		if i < n%k {
+			size++
+		}
+		validations[i] = indices[start : start+size]
+		start += size
+	}
+	return foldsFromValidations(validations), nil
+}
+
+// Same as KFold, but each class (see classKey) is spread evenly across the folds, so that they keep the class balance
+// of the dataset
+func StratifiedKFold(dataset Dataset, k int, rng *rand.Rand) ([]Fold, error) {
+	if k < 2 || k > len(dataset) {
+		return nil, fmt.Errorf("cannot split %d data points into %d folds", len(dataset), k)
+	}
+	validations := make([][]int, k)
+	// Dealing the data points to the folds like cards, continuing from one class to the next to balance the sizes
+	fold := 0
+	for _, indices := range classIndices(dataset) {
+		if rng != nil {
+			rng.Shuffle(len(indices), func(i, j int) { indices[i], indices[j] = indices[j], indices[i] })
+		}
+		for _, idx := range indices {
+			validations[fold] = append(validations[fold], idx)
+			fold = (fold + 1) % k
+		}
+	}
+	for _, v := range validations {
+		sort.Ints(v)
+	}
+	return foldsFromValidations(validations), nil
+}
+
+func foldsFromValidations(validations [][]int) []Fold {
+	folds := make([]Fold, len(validations))
+	for i := range folds {
+		folds[i].Validation = validations[i]
+		for j := range validations {
+			if j != i {
+				folds[i].Train = append(folds[i].Train, validations[j]...)
+			}
+		}
+	}
+	return folds
+}
+
+// Aggregated results of CrossValidate
+type CrossValidationResult struct {
+	// Logs returned for each fold
+	Folds []EpochLogs
+	// Mean and standard deviation across the folds, for the logs present in all of them
+	Mean map[string]float64
+	Std  map[string]float64
+}
+
+// Runs train on each fold, with the training and validation data points of the fold, then aggregates the returned
+// logs, e.g. the last epoch of NetworkTrainer.Fit or Network.EvaluateMetrics. A new network must be trained each time.
+func CrossValidate(dataset Dataset, folds []Fold, train func(fold int, train Dataset, validation Dataset) (EpochLogs, error)) (*CrossValidationResult, error) {
+	res := &CrossValidationResult{
+		Folds: make([]EpochLogs, len(folds)),
+		Mean:  make(map[string]float64),
+		Std:   make(map[string]float64),
+	}
+	for i, f := range folds {
+		logs, err := train(i, dataset.Subset(f.Train), dataset.Subset(f.Validation))
+		if err != nil {
+			return nil, fmt.Errorf("cannot train fold %d: %w", i, err)
+		}
+		res.Folds[i] = logs
+	}
+	if len(folds) == 0 {
+		return res, nil
+	}
+
+	for key := range res.Folds[0] {
+		values := make([]float64, 0, len(folds))
+		for _, logs := range res.Folds {
+			if v, ok := logs[key]; ok {
+				values = append(values, v)
+			}
+		}
+		if len(values) != len(folds) {
+			continue
+		}
+		mean := float64(0)
+		for _, v := range values {
+			mean += v
+		}
+		mean /= float64(len(values))
+		variance := float64(0)
+		for _, v := range values {
+			variance += (v - mean) * (v - mean)
+		}
+		res.Mean[key] = mean
+		res.Std[key] = math.Sqrt(variance / float64(len(values)))
+	}
+	return res, nil
+}
@@ -0,0 +1,78 @@
+package goflare
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 80 points of class 0 and 20 of class 1, the input being the index of the point
+func imbalancedDataset() Dataset {
+	dataset := make(Dataset, 100)
+	for i := range dataset {
+		dataset[i].Inputs = []float64{float64(i)}
+		if i%5 == 0 {
+			dataset[i].Outputs = []float64{0, 1}
+		} else {
+			dataset[i].Outputs = []float64{1, 0}
+		}
+	}
+	return dataset
+}
+
+func countClass1(d Dataset) (count int) {
+	for i := range d {
+		if d[i].Outputs[1] == 1 {
+			count++
+		}
+	}
+	return
+}
+
+func TestExactSplit(t *testing.T) {
+	assert := assert.New(t)
+	rng := rand.New(rand.NewSource(42))
+	datasets := ExactSplitWithSource(make([]int, 10000), []float64{0.7, 0.2, 0.1}, rng)
+	assert.Equal([]int{7000, 2000, 1000}, []int{len(datasets[0]), len(datasets[1]), len(datasets[2])})
+	assert.Equal([]int{4, 3, 3}, splitSizes(10, []float64{1, 1, 1}))
+	assert.Equal([]int{2, 1}, splitSizes(3, []float64{0.5, 0.5}))
+
+	train, test := StratifiedSplit2(imbalancedDataset(), 7, 3)
+	assert.Len(train, 70)
+	assert.Len(test, 30)
+	assert.Equal(14, countClass1(train))
+	assert.Equal(6, countClass1(test))
+}
+
+func TestKFold(t *testing.T) {
+	assert := assert.New(t)
+	folds, err := KFold(5, 2, nil)
+	assert.NoError(err)
+	assert.Equal([]Fold{{Train: []int{3, 4}, Validation: []int{0, 1, 2}}, {Train: []int{0, 1, 2}, Validation: []int{3, 4}}}, folds)
+	_, err = KFold(5, 6, nil)
+	assert.EqualError(err, "cannot split 5 data points into 6 folds")
+
+	dataset := imbalancedDataset()
+	folds, err = StratifiedKFold(dataset, 4, rand.New(rand.NewSource(42)))
+	assert.NoError(err)
+	seen := make(map[int]bool)
+	for _, f := range folds {
+		assert.Len(f.Validation, 25)
+		assert.Len(f.Train, 75)
+		assert.Equal(5, countClass1(dataset.Subset(f.Validation)))
+		for _, i := range f.Validation {
+			seen[i] = true
+		}
+	}
+	assert.Len(seen, 100)
+
+	res, err := CrossValidate(dataset, folds, func(fold int, train Dataset, validation Dataset) (EpochLogs, error) {
+		return EpochLogs{"fold": float64(fold), "size": float64(len(validation))}, nil
+	})
+	assert.NoError(err)
+	assert.Len(res.Folds, 4)
+	assert.Equal(map[string]float64{"fold": 1.5, "size": 25}, res.Mean)
+	assert.InDelta(1.118034, res.Std["fold"], 1e-6)
+	assert.Equal(0.0, res.Std["size"])
+}
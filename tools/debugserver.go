@@ -20,7 +20,7 @@ type DebugServer struct {
 	epoch     int
 }
 
-func NewDebugServer(nn *goflare.Network, testData []goflare.DataPoint, trainLoader goflare.DataLoader, optimizer *goflare.Optimizer) *DebugServer {
+func NewDebugServer(nn *goflare.Network, testData []goflare.DataPoint, trainLoader goflare.DataLoader, optimizer goflare.Optimizer) *DebugServer {
 	return &DebugServer{
 		nn:        nn,
 		trainData: testData,
@@ -73,7 +73,7 @@ func (s *DebugServer) handleApiLearn(w http.ResponseWriter, r *http.Request) {
 	logrus.Infof("Running training for %d epochs", query.Epoch)
 	trainer := goflare.NetworkTrainer{}
 	loader := goflare.NewDataLoader(s.trainData, query.BatchSize, true)
-	optimizer := goflare.NewOptimizer(s.nn, goflare.MSELoss, query.LearnRate, 0)
+	optimizer := goflare.NewSGD(s.nn, goflare.MSELoss, query.LearnRate, 0)
 	var trainLoss float64
 	for i := 0; i < query.Epoch; i++ {
 		s.epoch++